@@ -0,0 +1,559 @@
+package osdb
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+)
+
+// Archive signatures.
+var (
+	rar4Signature = []byte("Rar!\x1a\x07\x00")
+	rar5Signature = []byte("Rar!\x1a\x07\x01\x00")
+	zipSignature  = []byte("PK\x03\x04")
+	// Starts the first segment of split ZIP archives.
+	zipSpanSignature = []byte("PK\x07\x08")
+	zipEndSignature  = []byte("PK\x05\x06")
+)
+
+// ErrMultiVolumeZIP is returned for ZIP archives split in many files,
+// e.g. "movie.z01", "movie.z02", "movie.zip": unlike RAR volumes, their
+// segments can't be read.
+var ErrMultiVolumeZIP = errors.New("multi-volume ZIP not supported")
+
+// Segments of split ZIP archives, before the last ".zip" one.
+var zipSegmentRe = regexp.MustCompile(`(?i)\.z\d\d$`)
+
+// CompressedError is returned for compressed archive entries: only
+// stored entries can be read, and hashed, without extracting them.
+type CompressedError struct {
+	Archive string
+	Entry   string
+}
+
+func (e *CompressedError) Error() string {
+	return fmt.Sprintf("%s: %s is compressed, only stored (uncompressed) entries can be hashed", e.Archive, e.Entry)
+}
+
+// ArchiveVideo is the video file stored in a RAR or ZIP archive. It
+// reads the entry from the archive volumes, without extracting it.
+type ArchiveVideo struct {
+	Name string // of the entry, in the archive
+	Size int64
+
+	parts []archivePart
+	files []*os.File
+}
+
+// A piece of an entry's data, in a volume.
+type archivePart struct {
+	r      io.ReaderAt
+	offset int64 // in the volume
+	size   int64
+}
+
+// An archive entry, as found in volume headers.
+type archiveEntry struct {
+	name       string
+	size       int64
+	dir        bool
+	stored     bool
+	encrypted  bool
+	splitAfter bool // continues in the next volume
+	parts      []archivePart
+}
+
+// OpenArchive finds the video in a ZIP archive, or in a RAR archive,
+// which may span many volumes: "movie.part1.rar", "movie.part2.rar", or
+// "movie.rar", "movie.r00", etc. Give it the first volume. The video is
+// the largest file in the archive, and it must be stored, not
+// compressed, or a *CompressedError is returned. ZIP archives must fit
+// in a single file, or ErrMultiVolumeZIP is returned.
+func OpenArchive(path string) (*ArchiveVideo, error) {
+	v := &ArchiveVideo{}
+	entries, err := v.readVolumes(path)
+	if err != nil {
+		v.Close()
+		return nil, err
+	}
+
+	var video *archiveEntry
+	for _, e := range entries {
+		if !e.dir && (video == nil || e.size > video.size) {
+			video = e
+		}
+	}
+	switch {
+	case video == nil:
+		err = fmt.Errorf("%s: no file in archive", path)
+	case video.encrypted:
+		err = fmt.Errorf("%s: %s is encrypted", path, video.name)
+	case !video.stored:
+		err = &CompressedError{path, video.name}
+	case video.splitAfter:
+		err = fmt.Errorf("%s: missing volumes after %s", path, filepath.Base(v.files[len(v.files)-1].Name()))
+	}
+	if err == nil {
+		var total int64
+		for _, p := range video.parts {
+			total += p.size
+		}
+		if total != video.size {
+			err = fmt.Errorf("%s: %s has %d bytes in volumes, expected %d", path, video.name, total, video.size)
+		}
+	}
+	if err != nil {
+		v.Close()
+		return nil, err
+	}
+
+	v.Name, v.Size, v.parts = video.name, video.size, video.parts
+	return v, nil
+}
+
+// Read the entries of all the volumes of an archive.
+func (v *ArchiveVideo) readVolumes(path string) ([]*archiveEntry, error) {
+	entries := []*archiveEntry{}
+	byName := map[string]*archiveEntry{}
+	if zipSegmentRe.MatchString(path) {
+		return nil, ErrMultiVolumeZIP
+	}
+	for volume := path; ; volume = nextVolume(volume) {
+		f, err := os.Open(volume)
+		if err != nil {
+			return nil, err
+		}
+		v.files = append(v.files, f)
+
+		head := make([]byte, len(rar5Signature))
+		n, _ := f.ReadAt(head, 0)
+		head = head[:n]
+		var found []*archiveEntry
+		switch {
+		case bytes.HasPrefix(head, rar5Signature):
+			found, err = readRAR5(f)
+		case bytes.HasPrefix(head, rar4Signature):
+			found, err = readRAR4(f)
+		case bytes.HasPrefix(head, zipSignature) && volume == path:
+			found, err = readZIP(f)
+		case bytes.HasPrefix(head, zipSpanSignature):
+			err = ErrMultiVolumeZIP
+		default:
+			err = errors.New("not a RAR or ZIP archive")
+		}
+		if err == ErrMultiVolumeZIP {
+			return nil, err
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", volume, err)
+		}
+
+		more := false
+		for _, e := range found {
+			prev, ok := byName[e.name]
+			if !ok {
+				byName[e.name] = e
+				entries = append(entries, e)
+				more = more || e.splitAfter
+				continue
+			}
+			prev.parts = append(prev.parts, e.parts...)
+			prev.stored = prev.stored && e.stored
+			prev.encrypted = prev.encrypted || e.encrypted
+			prev.splitAfter = e.splitAfter
+			more = more || e.splitAfter
+		}
+		if !more {
+			return entries, nil
+		}
+		if _, err := os.Stat(nextVolume(volume)); err != nil {
+			return entries, nil // reported as missing volumes
+		}
+	}
+}
+
+// ReadAt reads the video data at off, across volumes.
+func (v *ArchiveVideo) ReadAt(p []byte, off int64) (int, error) {
+	read := 0
+	for _, part := range v.parts {
+		if len(p) == 0 {
+			break
+		}
+		if off >= part.size {
+			off -= part.size
+			continue
+		}
+		want := int64(len(p))
+		if want > part.size-off {
+			want = part.size - off
+		}
+		n, err := part.r.ReadAt(p[:want], part.offset+off)
+		read += n
+		if int64(n) < want {
+			if err == nil || err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return read, err
+		}
+		p, off = p[n:], 0
+	}
+	if len(p) > 0 {
+		return read, io.EOF
+	}
+	return read, nil
+}
+
+// Close the archive volumes.
+func (v *ArchiveVideo) Close() error {
+	var err error
+	for _, f := range v.files {
+		if e := f.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	v.files = nil
+	return err
+}
+
+// HashArchive generates an OSDB hash for the video stored in an archive,
+// see OpenArchive. It also returns the video size.
+func HashArchive(path string) (hash uint64, size int64, err error) {
+	v, err := OpenArchive(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer v.Close()
+	hash, err = HashReaderAt(v, v.Size)
+	return hash, v.Size, err
+}
+
+var (
+	partVolumeRe = regexp.MustCompile(`(?i)^(.*\.part)(\d+)(\.rar)$`)
+	oldVolumeRe  = regexp.MustCompile(`(?i)^(.*\.)([a-z])(\d\d)$`)
+)
+
+// Name of the volume after path: "movie.part2.rar" after
+// "movie.part1.rar", or "movie.r00" after "movie.rar", "movie.s00"
+// after "movie.r99", etc.
+func nextVolume(path string) string {
+	if m := partVolumeRe.FindStringSubmatch(path); m != nil {
+		n, _ := strconv.Atoi(m[2])
+		return fmt.Sprintf("%s%0*d%s", m[1], len(m[2]), n+1, m[3])
+	}
+	if m := oldVolumeRe.FindStringSubmatch(path); m != nil {
+		n, _ := strconv.Atoi(m[3])
+		letter := m[2][0]
+		if n == 99 {
+			letter, n = letter+1, -1
+		}
+		return fmt.Sprintf("%s%c%02d", m[1], letter, n+1)
+	}
+	ext := filepath.Ext(path)
+	r := "r"
+	if ext == ".RAR" {
+		r = "R"
+	}
+	return path[:len(path)-len(ext)] + "." + r + "00"
+}
+
+// RAR 4 block types and flags.
+const (
+	rar4Main         = 0x73
+	rar4File         = 0x74
+	rar4End          = 0x7b
+	rar4LongBlock    = 0x8000
+	rar4MainPassword = 0x0080
+	rar4SplitAfter   = 0x0002
+	rar4Encrypted    = 0x0004
+	rar4Directory    = 0x00e0
+	rar4Large        = 0x0100
+	rar4MethodStore  = 0x30
+)
+
+// Read the file entries of a RAR 4 volume.
+func readRAR4(r io.ReaderAt) ([]*archiveEntry, error) {
+	entries := []*archiveEntry{}
+	pos := int64(len(rar4Signature))
+	for {
+		base := make([]byte, 7)
+		if _, err := r.ReadAt(base, pos); err != nil {
+			if err == io.EOF {
+				return entries, nil // no end block
+			}
+			return nil, err
+		}
+		typ := base[2]
+		flags := binary.LittleEndian.Uint16(base[3:])
+		size := int64(binary.LittleEndian.Uint16(base[5:]))
+		if size < 7 {
+			return nil, fmt.Errorf("invalid RAR header at %d", pos)
+		}
+		head := make([]byte, size)
+		if _, err := r.ReadAt(head, pos); err != nil {
+			return nil, err
+		}
+
+		var dataSize int64
+		if flags&rar4LongBlock != 0 || typ == rar4File {
+			if size < 11 {
+				return nil, fmt.Errorf("invalid RAR header at %d", pos)
+			}
+			dataSize = int64(binary.LittleEndian.Uint32(head[7:]))
+		}
+		switch typ {
+		case rar4Main:
+			if flags&rar4MainPassword != 0 {
+				return nil, errors.New("archive headers are encrypted")
+			}
+		case rar4File:
+			if size < 32 {
+				return nil, fmt.Errorf("invalid RAR file header at %d", pos)
+			}
+			unpacked := int64(binary.LittleEndian.Uint32(head[11:]))
+			nameSize := int(binary.LittleEndian.Uint16(head[26:]))
+			nameAt := 32
+			if flags&rar4Large != 0 {
+				if size < 40 {
+					return nil, fmt.Errorf("invalid RAR file header at %d", pos)
+				}
+				dataSize += int64(binary.LittleEndian.Uint32(head[32:])) << 32
+				unpacked += int64(binary.LittleEndian.Uint32(head[36:])) << 32
+				nameAt = 40
+			}
+			if nameAt+nameSize > len(head) {
+				return nil, fmt.Errorf("invalid RAR file header at %d", pos)
+			}
+			name := head[nameAt : nameAt+nameSize]
+			if i := bytes.IndexByte(name, 0); i >= 0 {
+				name = name[:i] // followed by the Unicode name
+			}
+			entries = append(entries, &archiveEntry{
+				name:       string(name),
+				size:       unpacked,
+				dir:        flags&rar4Directory == rar4Directory,
+				stored:     head[25] == rar4MethodStore,
+				encrypted:  flags&rar4Encrypted != 0,
+				splitAfter: flags&rar4SplitAfter != 0,
+				parts:      []archivePart{{r, pos + size, dataSize}},
+			})
+		case rar4End:
+			return entries, nil
+		}
+		pos += size + dataSize
+	}
+}
+
+// RAR 5 header types and flags.
+const (
+	rar5Main            = 1
+	rar5File            = 2
+	rar5Encryption      = 4
+	rar5End             = 5
+	rar5HasExtra        = 0x01
+	rar5HasData         = 0x02
+	rar5SplitAfter      = 0x10
+	rar5Directory       = 0x01
+	rar5HasTime         = 0x02
+	rar5HasCRC          = 0x04
+	rar5UnknownSize     = 0x08
+	rar5ExtraEncryption = 0x01
+)
+
+// Read the file entries of a RAR 5 volume.
+func readRAR5(r io.ReaderAt) ([]*archiveEntry, error) {
+	entries := []*archiveEntry{}
+	pos := int64(len(rar5Signature))
+	for {
+		// CRC32, and the header size in up to 3 bytes.
+		start := make([]byte, 7)
+		n, err := r.ReadAt(start, pos)
+		if n == 0 && err == io.EOF {
+			return entries, nil // no end header
+		}
+		if n < 5 {
+			return nil, fmt.Errorf("truncated RAR header at %d", pos)
+		}
+		hs := &vintReader{buf: start[4:n]}
+		headSize := int64(hs.read())
+		if hs.err != nil || headSize == 0 || headSize > 2<<20 {
+			return nil, fmt.Errorf("invalid RAR header at %d", pos)
+		}
+		headAt := pos + 4 + int64(hs.pos)
+		buf := make([]byte, headSize)
+		if _, err := r.ReadAt(buf, headAt); err != nil {
+			return nil, err
+		}
+
+		h := &vintReader{buf: buf}
+		typ := h.read()
+		flags := h.read()
+		var extraSize, dataSize uint64
+		if flags&rar5HasExtra != 0 {
+			extraSize = h.read()
+		}
+		if flags&rar5HasData != 0 {
+			dataSize = h.read()
+		}
+		dataAt := headAt + headSize
+
+		switch typ {
+		case rar5Encryption:
+			return nil, errors.New("archive headers are encrypted")
+		case rar5File:
+			fileFlags := h.read()
+			unpacked := h.read()
+			h.read() // attributes
+			if fileFlags&rar5HasTime != 0 {
+				h.skip(4)
+			}
+			if fileFlags&rar5HasCRC != 0 {
+				h.skip(4)
+			}
+			compression := h.read()
+			h.read() // host OS
+			name := h.bytes(int(h.read()))
+			if h.err != nil {
+				return nil, fmt.Errorf("invalid RAR file header at %d", pos)
+			}
+			if fileFlags&rar5UnknownSize != 0 {
+				return nil, fmt.Errorf("%s has an unknown size", name)
+			}
+			encrypted := false
+			if extraSize > 0 && extraSize <= uint64(len(buf)) {
+				encrypted = rar5Encrypted(buf[len(buf)-int(extraSize):])
+			}
+			entries = append(entries, &archiveEntry{
+				name:       string(name),
+				size:       int64(unpacked),
+				dir:        fileFlags&rar5Directory != 0,
+				stored:     compression>>7&0x07 == 0,
+				encrypted:  encrypted,
+				splitAfter: flags&rar5SplitAfter != 0,
+				parts:      []archivePart{{r, dataAt, int64(dataSize)}},
+			})
+		case rar5End:
+			return entries, nil
+		}
+		if h.err != nil {
+			return nil, fmt.Errorf("invalid RAR header at %d", pos)
+		}
+		pos = dataAt + int64(dataSize)
+	}
+}
+
+// Whether the extra area of a RAR 5 file header has an encryption
+// record.
+func rar5Encrypted(extra []byte) bool {
+	e := &vintReader{buf: extra}
+	for e.pos < len(extra) && e.err == nil {
+		size := e.read()
+		next := e.pos + int(size)
+		if e.read() == rar5ExtraEncryption {
+			return true
+		}
+		e.pos = next
+	}
+	return false
+}
+
+// Reads RAR 5 variable-length integers: 7 bits per byte, least
+// significant first, with the high bit set on all bytes but the last.
+type vintReader struct {
+	buf []byte
+	pos int
+	err error
+}
+
+var errTruncated = errors.New("truncated header")
+
+func (v *vintReader) read() uint64 {
+	var n uint64
+	for shift := uint(0); shift < 70; shift += 7 {
+		if v.err != nil || v.pos >= len(v.buf) {
+			v.err = errTruncated
+			return 0
+		}
+		b := v.buf[v.pos]
+		v.pos++
+		n |= uint64(b&0x7f) << shift
+		if b&0x80 == 0 {
+			return n
+		}
+	}
+	v.err = errTruncated
+	return 0
+}
+
+func (v *vintReader) skip(n int) {
+	v.bytes(n)
+}
+
+func (v *vintReader) bytes(n int) []byte {
+	if v.err != nil || n < 0 || v.pos+n > len(v.buf) {
+		v.err = errTruncated
+		return nil
+	}
+	b := v.buf[v.pos : v.pos+n]
+	v.pos += n
+	return b
+}
+
+// Read the file entries of a ZIP archive.
+func readZIP(f *os.File) ([]*archiveEntry, error) {
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if zipMultiVolume(f, fi.Size()) {
+		return nil, ErrMultiVolumeZIP
+	}
+	z, err := zip.NewReader(f, fi.Size())
+	if err != nil {
+		return nil, err
+	}
+	entries := []*archiveEntry{}
+	for _, zf := range z.File {
+		offset, err := zf.DataOffset()
+		if err != nil {
+			return nil, err
+		}
+		size := int64(zf.UncompressedSize64)
+		entries = append(entries, &archiveEntry{
+			name:      zf.Name,
+			size:      size,
+			dir:       zf.FileInfo().IsDir(),
+			stored:    zf.Method == zip.Store,
+			encrypted: zf.Flags&0x1 != 0,
+			parts:     []archivePart{{f, offset, size}},
+		})
+	}
+	return entries, nil
+}
+
+// Whether a ZIP file is the last segment of a split archive: its end of
+// central directory record is on another disk than the first one.
+func zipMultiVolume(r io.ReaderAt, size int64) bool {
+	// The record is 22 bytes, followed by a comment of up to 64 KiB.
+	n := int64(22 + 65535)
+	if n > size {
+		n = size
+	}
+	buf := make([]byte, n)
+	if _, err := r.ReadAt(buf, size-n); err != nil && err != io.EOF {
+		return false
+	}
+	i := bytes.LastIndex(buf, zipEndSignature)
+	if i < 0 || len(buf)-i < 22 {
+		return false
+	}
+	disk := binary.LittleEndian.Uint16(buf[i+4:])
+	dirDisk := binary.LittleEndian.Uint16(buf[i+6:])
+	return disk != 0 || dirDisk != 0
+}
@@ -0,0 +1,298 @@
+package osdb
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// A sample video, and its hash.
+func archiveSample(t *testing.T) ([]byte, uint64) {
+	data := make([]byte, ChunkSize*3+1234)
+	copy(data, []byte("blablabla"))
+	copy(data[len(data)-9:], []byte("tralalala"))
+	hash, err := HashReaderAt(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("Can't hash sample: %s", err)
+	}
+	return data, hash
+}
+
+func tempDir(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "osdb")
+	if err != nil {
+		t.Fatalf("Can't create temp dir: %s", err)
+	}
+	return dir, func() { os.RemoveAll(dir) }
+}
+
+// Split data in n volumes of about the same size.
+func splitVolumes(data []byte, n int) [][]byte {
+	parts := [][]byte{}
+	size := len(data)/n + 1
+	for len(data) > size {
+		parts = append(parts, data[:size])
+		data = data[size:]
+	}
+	return append(parts, data)
+}
+
+// A RAR 4 block, with its CRC.
+func rar4Block(typ byte, flags uint16, body []byte) []byte {
+	b := make([]byte, 7, 7+len(body))
+	b[2] = typ
+	binary.LittleEndian.PutUint16(b[3:], flags)
+	binary.LittleEndian.PutUint16(b[5:], uint16(7+len(body)))
+	b = append(b, body...)
+	binary.LittleEndian.PutUint16(b, uint16(crc32.ChecksumIEEE(b[2:])))
+	return b
+}
+
+// Write a RAR 4 archive of an nfo, and a video split in volumes.
+func writeRAR4(t *testing.T, paths []string, video []byte, method byte) {
+	parts := splitVolumes(video, len(paths))
+	for i, path := range paths {
+		buf := bytes.NewBuffer(append([]byte{}, rar4Signature...))
+		buf.Write(rar4Block(rar4Main, 0x0001, make([]byte, 6)))
+		if i == 0 {
+			nfo := []byte("release notes")
+			buf.Write(rar4FileBlock("movie.nfo", 0, int64(len(nfo)), nfo, rar4MethodStore))
+		}
+		var flags uint16
+		if i > 0 {
+			flags |= 0x0001
+		}
+		if i < len(paths)-1 {
+			flags |= rar4SplitAfter
+		}
+		buf.Write(rar4FileBlock("movie.avi", flags, int64(len(video)), parts[i], method))
+		buf.Write(rar4Block(rar4End, 0, nil))
+		if err := ioutil.WriteFile(path, buf.Bytes(), 0644); err != nil {
+			t.Fatalf("Can't write %s: %s", path, err)
+		}
+	}
+}
+
+func rar4FileBlock(name string, flags uint16, size int64, data []byte, method byte) []byte {
+	body := make([]byte, 25+len(name))
+	binary.LittleEndian.PutUint32(body[0:], uint32(len(data)))
+	binary.LittleEndian.PutUint32(body[4:], uint32(size))
+	body[8] = 2 // Unix
+	binary.LittleEndian.PutUint32(body[9:], crc32.ChecksumIEEE(data))
+	body[17] = 29 // version
+	body[18] = method
+	binary.LittleEndian.PutUint16(body[19:], uint16(len(name)))
+	copy(body[25:], name)
+	return append(rar4Block(rar4File, flags|rar4LongBlock, body), data...)
+}
+
+// RAR 5 variable-length integers.
+func vint(n uint64) []byte {
+	b := []byte{}
+	for n >= 0x80 {
+		b = append(b, byte(n)|0x80)
+		n >>= 7
+	}
+	return append(b, byte(n))
+}
+
+// A RAR 5 header, with its CRC and size.
+func rar5Header(fields ...[]byte) []byte {
+	head := bytes.Join(fields, nil)
+	b := append(vint(uint64(len(head))), head...)
+	crc := make([]byte, 4)
+	binary.LittleEndian.PutUint32(crc, crc32.ChecksumIEEE(b))
+	return append(crc, b...)
+}
+
+// Write a RAR 5 archive of a video split in volumes.
+func writeRAR5(t *testing.T, paths []string, video []byte, method uint64) {
+	parts := splitVolumes(video, len(paths))
+	for i, path := range paths {
+		buf := bytes.NewBuffer(append([]byte{}, rar5Signature...))
+		buf.Write(rar5Header(vint(rar5Main), vint(0), vint(0x01)))
+		flags := uint64(rar5HasData)
+		if i > 0 {
+			flags |= 0x08
+		}
+		if i < len(paths)-1 {
+			flags |= rar5SplitAfter
+		}
+		name := "movie.mkv"
+		buf.Write(rar5Header(
+			vint(rar5File), vint(flags), vint(uint64(len(parts[i]))),
+			vint(0), vint(uint64(len(video))), vint(0x20),
+			vint(method<<7|0), vint(1), vint(uint64(len(name))), []byte(name),
+		))
+		buf.Write(parts[i])
+		buf.Write(rar5Header(vint(rar5End), vint(0), vint(0)))
+		if err := ioutil.WriteFile(path, buf.Bytes(), 0644); err != nil {
+			t.Fatalf("Can't write %s: %s", path, err)
+		}
+	}
+}
+
+func writeZIP(t *testing.T, path string, video []byte, method uint16) {
+	buf := new(bytes.Buffer)
+	z := zip.NewWriter(buf)
+	for _, f := range []struct {
+		name string
+		data []byte
+	}{{"movie.nfo", []byte("release notes")}, {"movie.mp4", video}} {
+		w, err := z.CreateHeader(&zip.FileHeader{Name: f.name, Method: method})
+		if err != nil {
+			t.Fatalf("Can't create zip entry: %s", err)
+		}
+		w.Write(f.data)
+	}
+	z.Close()
+	if err := ioutil.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatalf("Can't write %s: %s", path, err)
+	}
+}
+
+func checkArchiveHash(t *testing.T, path string, want uint64, size int) {
+	hash, n, err := HashArchive(path)
+	if err != nil {
+		t.Fatalf("Expected hash, got error: %v", err)
+	}
+	if hash != want || n != int64(size) {
+		t.Fatalf("Expected hash 0x%016x of %d bytes, got 0x%016x of %d", want, size, hash, n)
+	}
+}
+
+func TestHashArchiveRAR4(t *testing.T) {
+	dir, done := tempDir(t)
+	defer done()
+	video, want := archiveSample(t)
+
+	// New volume names, and old ones.
+	paths := []string{}
+	for i := 1; i <= 3; i++ {
+		paths = append(paths, filepath.Join(dir, fmt.Sprintf("movie.part%02d.rar", i)))
+	}
+	writeRAR4(t, paths, video, rar4MethodStore)
+	checkArchiveHash(t, paths[0], want, len(video))
+
+	paths = []string{filepath.Join(dir, "old.rar"), filepath.Join(dir, "old.r00"), filepath.Join(dir, "old.r01")}
+	writeRAR4(t, paths, video, rar4MethodStore)
+	checkArchiveHash(t, paths[0], want, len(video))
+
+	os.Remove(paths[2])
+	if _, _, err := HashArchive(paths[0]); err == nil {
+		t.Fatalf("Expected an error for a missing volume")
+	}
+
+	single := filepath.Join(dir, "best.rar")
+	writeRAR4(t, []string{single}, video, 0x33)
+	if _, _, err := HashArchive(single); err == nil {
+		t.Fatalf("Expected an error for a compressed entry")
+	} else if _, ok := err.(*CompressedError); !ok {
+		t.Fatalf("Expected a *CompressedError, got %v", err)
+	}
+}
+
+func TestHashArchiveRAR5(t *testing.T) {
+	dir, done := tempDir(t)
+	defer done()
+	video, want := archiveSample(t)
+
+	paths := []string{filepath.Join(dir, "movie.part1.rar"), filepath.Join(dir, "movie.part2.rar")}
+	writeRAR5(t, paths, video, 0)
+	checkArchiveHash(t, paths[0], want, len(video))
+
+	v, err := OpenArchive(paths[0])
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	defer v.Close()
+	if v.Name != "movie.mkv" {
+		t.Fatalf("Expected movie.mkv, got %s", v.Name)
+	}
+	// Read across volumes.
+	buf := make([]byte, 100)
+	off := int64(len(video)/2 - 50)
+	if n, err := v.ReadAt(buf, off); n != 100 || err != nil || !bytes.Equal(buf, video[off:off+100]) {
+		t.Fatalf("Unexpected read across volumes: %d bytes, error: %v", n, err)
+	}
+
+	single := filepath.Join(dir, "best.rar")
+	writeRAR5(t, []string{single}, video, 3)
+	if _, ok := func() error { _, _, err := HashArchive(single); return err }().(*CompressedError); !ok {
+		t.Fatalf("Expected a *CompressedError")
+	}
+}
+
+func TestHashArchiveZIP(t *testing.T) {
+	dir, done := tempDir(t)
+	defer done()
+	video, want := archiveSample(t)
+
+	stored := filepath.Join(dir, "movie.zip")
+	writeZIP(t, stored, video, zip.Store)
+	checkArchiveHash(t, stored, want, len(video))
+
+	deflated := filepath.Join(dir, "deflated.zip")
+	writeZIP(t, deflated, video, zip.Deflate)
+	if _, ok := func() error { _, _, err := HashArchive(deflated); return err }().(*CompressedError); !ok {
+		t.Fatalf("Expected a *CompressedError")
+	}
+}
+
+func TestHashArchiveMultiVolumeZIP(t *testing.T) {
+	dir, done := tempDir(t)
+	defer done()
+	video, _ := archiveSample(t)
+
+	// The last segment of a split archive: its central directory is on
+	// the second disk.
+	last := filepath.Join(dir, "movie.zip")
+	writeZIP(t, last, video, zip.Store)
+	data, _ := ioutil.ReadFile(last)
+	end := bytes.LastIndex(data, []byte("PK\x05\x06"))
+	data[end+4], data[end+6] = 1, 1
+	ioutil.WriteFile(last, data, 0644)
+
+	first := filepath.Join(dir, "movie.z01")
+	ioutil.WriteFile(first, append([]byte("PK\x07\x08"), video...), 0644)
+	spanned := filepath.Join(dir, "spanned.zip")
+	ioutil.WriteFile(spanned, append([]byte("PK\x07\x08"), video...), 0644)
+
+	for _, path := range []string{last, first, spanned} {
+		if _, _, err := HashArchive(path); err != ErrMultiVolumeZIP {
+			t.Fatalf("%s: expected ErrMultiVolumeZIP, got %v", path, err)
+		}
+	}
+}
+
+func TestHashArchiveInvalid(t *testing.T) {
+	dir, done := tempDir(t)
+	defer done()
+	path := filepath.Join(dir, "movie.rar")
+	ioutil.WriteFile(path, []byte("not an archive"), 0644)
+	if _, _, err := HashArchive(path); err == nil {
+		t.Fatalf("Expected an error, got none")
+	}
+}
+
+func TestNextVolume(t *testing.T) {
+	for path, want := range map[string]string{
+		"movie.part1.rar":   "movie.part2.rar",
+		"movie.part09.rar":  "movie.part10.rar",
+		"movie.PART001.RAR": "movie.PART002.RAR",
+		"movie.rar":         "movie.r00",
+		"movie.RAR":         "movie.R00",
+		"movie.r00":         "movie.r01",
+		"movie.r99":         "movie.s00",
+	} {
+		if got := nextVolume(path); got != want {
+			t.Errorf("Expected %s after %s, got %s", want, path, got)
+		}
+	}
+}
@@ -0,0 +1,309 @@
+package osdb
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	// SearchBatchSize is the maximum number of criteria sent in a single
+	// SearchSubtitles call.
+	SearchBatchSize = 20
+
+	// DownloadBatchSize is the maximum number of subtitle files
+	// requested in a single DownloadSubtitles call.
+	DownloadBatchSize = 20
+)
+
+// ErrNoSubtitleFile is the error of downloads that returned no file.
+var ErrNoSubtitleFile = errors.New("No file match this subtitle ID")
+
+// DownloadResult is the outcome of downloading a subtitle file: the file,
+// or an error.
+type DownloadResult struct {
+	ID   int
+	File *SubtitleFile
+	Err  error
+}
+
+// HashQuery is a movie hash search criterion, for BatchHashSearch.
+type HashQuery struct {
+	Hash  uint64
+	Size  int64
+	Langs []string
+}
+
+// FileSearchResult is the outcome of searching subtitles for a file: its
+// subtitles, or an error when it couldn't be hashed.
+type FileSearchResult struct {
+	Path      string
+	Subtitles Subtitles
+	Err       error
+}
+
+// BatchFileSearch searches subtitles for many files at once, in
+// languages. Files are sent SearchBatchSize at a time, and the results
+// are returned in the order of paths, one per file. Files that can't be
+// hashed are not searched, and get an error, while a failed search
+// returns an error for all files.
+func (c *Client) BatchFileSearch(paths []string, langs []string) ([]FileSearchResult, error) {
+	results := make([]FileSearchResult, len(paths))
+	queries := []HashQuery{}
+	sent := []int{} // indexes of the files in queries
+	for i, path := range paths {
+		results[i].Path = path
+		q, err := c.fileQuery(path, langs)
+		if err != nil {
+			results[i].Err = fmt.Errorf("%s: %s", path, err)
+			continue
+		}
+		queries = append(queries, q)
+		sent = append(sent, i)
+	}
+	subs, err := c.BatchHashSearch(queries)
+	if err != nil {
+		return nil, err
+	}
+	for j, i := range sent {
+		results[i].Subtitles = subs[j]
+	}
+	return results, nil
+}
+
+// Hash a file into a search query.
+func (c *Client) fileQuery(path string, langs []string) (HashQuery, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return HashQuery{}, err
+	}
+	defer file.Close()
+	fi, err := file.Stat()
+	if err != nil {
+		return HashQuery{}, err
+	}
+	hash, err := c.HashCache.HashFile(file)
+	if err != nil {
+		return HashQuery{}, err
+	}
+	return HashQuery{Hash: hash, Size: fi.Size(), Langs: langs}, nil
+}
+
+// BatchHashSearch searches subtitles for many movie hashes at once, in
+// batches of SearchBatchSize. The results are returned in the order of
+// queries, one Subtitles per query.
+func (c *Client) BatchHashSearch(queries []HashQuery) ([]Subtitles, error) {
+	results := make([]Subtitles, len(queries))
+	for start := 0; start < len(queries); start += SearchBatchSize {
+		end := start + SearchBatchSize
+		if end > len(queries) {
+			end = len(queries)
+		}
+		if err := c.hashSearchBatch(queries[start:end], results[start:end]); err != nil {
+			return nil, err
+		}
+	}
+	return results, nil
+}
+
+// Send a batch of queries in a single call, and dispatch the subtitles
+// in results, from their QueryNumber.
+func (c *Client) hashSearchBatch(queries []HashQuery, results []Subtitles) error {
+	type criterion struct {
+		Hash  string `xmlrpc:"moviehash"`
+		Size  int64  `xmlrpc:"moviebytesize"`
+		Langs string `xmlrpc:"sublanguageid"`
+	}
+	// Queries are cached one by one, like single-file searches, and
+	// only the missing ones are sent.
+	criteria := []criterion{}
+	sent := []int{} // indexes of the queries in criteria
+	for i, q := range queries {
+		cr := criterion{hashString(q.Hash), q.Size, strings.Join(q.Langs, ",")}
+		if subs, ok := c.Cache.search([]interface{}{[]criterion{cr}}); ok {
+			results[i] = subs
+			continue
+		}
+		criteria = append(criteria, cr)
+		sent = append(sent, i)
+	}
+	if len(criteria) == 0 {
+		return nil
+	}
+
+	params := []interface{}{c.Token, criteria}
+	res := struct {
+		Data Subtitles `xmlrpc:"data"`
+	}{}
+	if err := c.Call("SearchSubtitles", params, &res); err != nil {
+		return err
+	}
+	for _, s := range res.Data {
+		n, err := strconv.Atoi(s.QueryNumber)
+		if err != nil || n < 0 || n >= len(sent) {
+			return fmt.Errorf("SearchSubtitles returned an invalid QueryNumber: %q", s.QueryNumber)
+		}
+		results[sent[n]] = append(results[sent[n]], s)
+	}
+	for n, i := range sent {
+		c.Cache.putSearch([]interface{}{criteria[n : n+1]}, results[i])
+	}
+	return nil
+}
+
+// BatchDownload downloads subtitle files by ID, DownloadBatchSize at a
+// time. Files are matched to IDs from their idsubtitlefile, and the
+// results are returned in the order of ids. When a batch fails, its IDs
+// are downloaded one by one, so that a bad ID only fails its own result.
+// Once the download quota is used, all the remaining results get a
+// *DownloadLimitError, without calling OSDB again. Files found in
+// c.Cache are not downloaded, and don't count in the quota.
+func (c *Client) BatchDownload(ids []int) []DownloadResult {
+	results := make([]DownloadResult, len(ids))
+	missing := []int{} // indexes of the results to download
+	for i, id := range ids {
+		results[i].ID = id
+		if results[i].File = c.Cache.file(id); results[i].File == nil {
+			missing = append(missing, i)
+		}
+	}
+	if len(missing) == 0 {
+		return results
+	}
+
+	pending := make([]DownloadResult, len(missing))
+	for k, i := range missing {
+		pending[k].ID = ids[i]
+	}
+	c.downloadBatches(pending)
+	for k, i := range missing {
+		results[i] = pending[k]
+		if results[i].Err == nil {
+			c.Cache.putFile(results[i].File)
+		}
+	}
+	return results
+}
+
+// Download results DownloadBatchSize at a time, see BatchDownload.
+func (c *Client) downloadBatches(results []DownloadResult) {
+	for start := 0; start < len(results); start += DownloadBatchSize {
+		end := start + DownloadBatchSize
+		if end > len(results) {
+			end = len(results)
+		}
+		batch := results[start:end]
+		err := c.downloadBatch(batch)
+		if _, ok := err.(*DownloadLimitError); ok {
+			for i := end; i < len(results); i++ {
+				results[i].Err = err
+			}
+			break
+		}
+		if err != nil && len(batch) > 1 {
+			for i := range batch {
+				if err := c.downloadBatch(batch[i : i+1]); err != nil {
+					if _, ok := err.(*DownloadLimitError); ok {
+						for k := start + i; k < len(results); k++ {
+							results[k].Err = err
+						}
+						return
+					}
+				}
+			}
+		}
+	}
+}
+
+// BatchDownloadSubtitles downloads subtitles like BatchDownload, and
+// decodes each file with the encoding of its subtitle.
+func (c *Client) BatchDownloadSubtitles(subtitles Subtitles) []DownloadResult {
+	ids := make([]int, len(subtitles))
+	bad := make([]error, len(subtitles))
+	for i := range subtitles {
+		id, err := strconv.Atoi(subtitles[i].IDSubtitleFile)
+		if err != nil {
+			bad[i] = fmt.Errorf("malformed subtitle ID: %s", err)
+		}
+		ids[i] = id
+	}
+
+	results := make([]DownloadResult, len(subtitles))
+	good := []int{} // indexes of subtitles with valid IDs
+	for i := range subtitles {
+		if bad[i] != nil {
+			results[i] = DownloadResult{Err: bad[i]}
+			continue
+		}
+		good = append(good, ids[i])
+	}
+	downloaded := c.BatchDownload(good)
+
+	for i := range subtitles {
+		if bad[i] != nil {
+			continue
+		}
+		results[i], downloaded = downloaded[0], downloaded[1:]
+		if results[i].Err != nil {
+			continue
+		}
+		sf := results[i].File
+		if name := subtitles[i].SubEncoding; name != "" {
+			if sf.Encoding, results[i].Err = encodingFromName(name); results[i].Err != nil {
+				continue
+			}
+		}
+		// Decode now, rather than on first read.
+		_, results[i].Err = sf.Bytes()
+	}
+	return results
+}
+
+// Download a batch of subtitle files in a single call, and fill their
+// results. It returns the error of the call, if any, which is also set
+// in all the results.
+func (c *Client) downloadBatch(batch []DownloadResult) error {
+	ids := []int{}
+	seen := map[int]bool{}
+	for _, r := range batch {
+		if !seen[r.ID] {
+			ids = append(ids, r.ID)
+			seen[r.ID] = true
+		}
+	}
+
+	params := []interface{}{c.Token, ids}
+	res := struct {
+		Status string         `xmlrpc:"status"`
+		Data   []SubtitleFile `xmlrpc:"data"`
+	}{}
+	err := c.Call("DownloadSubtitles", params, &res)
+	if err == nil && isDownloadLimit(res.Status) {
+		err = c.QuotaError(res.Status)
+	} else if err == nil && res.Status != StatusSuccess {
+		err = fmt.Errorf("DownloadSubtitles error: %s", res.Status)
+	}
+	if err != nil {
+		for i := range batch {
+			batch[i].Err = err
+		}
+		return err
+	}
+
+	files := map[string]SubtitleFile{}
+	for _, f := range res.Data {
+		files[f.ID] = f
+	}
+	c.countDownloads(len(files))
+	for i := range batch {
+		f, ok := files[strconv.Itoa(batch[i].ID)]
+		if !ok {
+			batch[i].File, batch[i].Err = nil, ErrNoSubtitleFile
+			continue
+		}
+		batch[i].File, batch[i].Err = &f, nil
+	}
+	return nil
+}
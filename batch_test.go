@@ -0,0 +1,326 @@
+package osdb
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/kolo/xmlrpc"
+)
+
+var methodNameRe = regexp.MustCompile(`<methodName>([^<]*)</methodName>`)
+
+// Start a fake OSDB server, answering calls with handler, which gets
+// the method name and the raw request body.
+func newTestServer(t *testing.T, handler func(method string, body []byte) interface{}) (*Client, func()) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		m := methodNameRe.FindSubmatch(body)
+		if m == nil {
+			t.Errorf("Unexpected request: %s", body)
+			return
+		}
+		res, err := xmlrpc.EncodeMethodCall("r", handler(string(m[1]), body))
+		if err != nil {
+			t.Errorf("Can't encode response: %s", err)
+			return
+		}
+		res = bytes.Replace(res, []byte("<methodCall><methodName>r</methodName>"), []byte("<methodResponse>"), 1)
+		res = bytes.Replace(res, []byte("</methodCall>"), []byte("</methodResponse>"), 1)
+		w.Header().Set("Content-Type", "text/xml")
+		w.Write(res)
+	}))
+
+	rpc, err := xmlrpc.NewClient(srv.URL, nil)
+	if err != nil {
+		t.Fatalf("Can't create client: %s", err)
+	}
+	c := &Client{UserAgent: DefaultUserAgent, Client: rpc}
+	return c, srv.Close
+}
+
+// Decode the n-th parameter (from 0) of a call's request body into v.
+// It runs in server handlers, so it reports errors without stopping the
+// test.
+func requestParam(t *testing.T, body []byte, n int, v interface{}) {
+	params := strings.Split(string(body), "<param>")
+	if n+1 >= len(params) {
+		t.Errorf("Missing param %d in %s", n, body)
+		return
+	}
+	res := "<methodResponse><params><param>" + params[n+1]
+	if err := xmlrpc.NewResponse([]byte(res)).Unmarshal(v); err != nil {
+		t.Errorf("Can't decode param %d: %s", n, err)
+	}
+}
+
+func TestBatchHashSearch(t *testing.T) {
+	calls := 0
+	c, done := newTestServer(t, func(method string, body []byte) interface{} {
+		if method != "SearchSubtitles" {
+			t.Errorf("Unexpected call to %s", method)
+		}
+		calls++
+		criteria := []struct {
+			Hash  string `xmlrpc:"moviehash"`
+			Size  int64  `xmlrpc:"moviebytesize"`
+			Langs string `xmlrpc:"sublanguageid"`
+		}{}
+		requestParam(t, body, 1, &criteria)
+		if calls == 1 && len(criteria) != SearchBatchSize {
+			t.Errorf("Expected %d criteria, got %d", SearchBatchSize, len(criteria))
+		}
+
+		// One subtitle for even hashes, answered in reverse order.
+		data := []map[string]string{}
+		for i := len(criteria) - 1; i >= 0; i-- {
+			if strings.HasSuffix(criteria[i].Hash, "0") {
+				data = append(data, map[string]string{
+					"IDSubtitleFile": criteria[i].Hash,
+					"SubLanguageID":  criteria[i].Langs,
+					"QueryNumber":    strconv.Itoa(i),
+				})
+			}
+		}
+		return map[string]interface{}{"status": StatusSuccess, "data": data}
+	})
+	defer done()
+
+	queries := make([]HashQuery, SearchBatchSize+5)
+	for i := range queries {
+		queries[i] = HashQuery{Hash: uint64(i * 8), Size: 100000, Langs: []string{"eng", "fre"}}
+	}
+	results, err := c.BatchHashSearch(queries)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if calls != 2 {
+		t.Fatalf("Expected 2 calls, got %d", calls)
+	}
+	if len(results) != len(queries) {
+		t.Fatalf("Expected %d results, got %d", len(queries), len(results))
+	}
+	for i, subs := range results {
+		want := 0
+		if i%2 == 0 {
+			want = 1
+		}
+		if len(subs) != want {
+			t.Fatalf("Expected %d subtitles for query %d, got %d", want, i, len(subs))
+		}
+		if want == 1 && subs[0].IDSubtitleFile != hashString(queries[i].Hash) {
+			t.Fatalf("Expected subtitle %s for query %d, got %s", hashString(queries[i].Hash), i, subs[0].IDSubtitleFile)
+		}
+		if want == 1 && subs[0].SubLanguageID != "eng,fre" {
+			t.Fatalf("Expected languages eng,fre, got %s", subs[0].SubLanguageID)
+		}
+	}
+}
+
+func TestBatchHashSearchInvalidQueryNumber(t *testing.T) {
+	c, done := newTestServer(t, func(method string, body []byte) interface{} {
+		return map[string]interface{}{
+			"status": StatusSuccess,
+			"data":   []map[string]string{{"IDSubtitleFile": "1", "QueryNumber": "3"}},
+		}
+	})
+	defer done()
+
+	if _, err := c.BatchHashSearch([]HashQuery{{Hash: 1, Size: 100000}}); err == nil {
+		t.Fatalf("Expected an error for an unknown QueryNumber")
+	}
+}
+
+func TestBatchFileSearch(t *testing.T) {
+	dir, done := tempDir(t)
+	defer done()
+
+	// Movies, with a file too small to hash and a missing one among
+	// them.
+	paths := []string{}
+	for i, name := range []string{"a.avi", "small.avi", "b.avi", "missing.avi", "c.avi"} {
+		path := filepath.Join(dir, name)
+		paths = append(paths, path)
+		size := ChunkSize * 2
+		switch name {
+		case "missing.avi":
+			continue
+		case "small.avi":
+			size = 10
+		}
+		data := bytes.Repeat([]byte{byte(i + 1)}, size)
+		if err := ioutil.WriteFile(path, data, 0644); err != nil {
+			t.Fatalf("Can't write %s: %s", path, err)
+		}
+	}
+
+	calls := 0
+	c, stop := newTestServer(t, func(method string, body []byte) interface{} {
+		calls++
+		criteria := []struct {
+			Hash string `xmlrpc:"moviehash"`
+		}{}
+		requestParam(t, body, 1, &criteria)
+		if len(criteria) != 3 {
+			t.Errorf("Expected 3 criteria, got %d", len(criteria))
+		}
+		// A subtitle per hash, answered in reverse order.
+		data := []map[string]string{}
+		for i := len(criteria) - 1; i >= 0; i-- {
+			data = append(data, map[string]string{
+				"IDSubtitleFile": criteria[i].Hash,
+				"QueryNumber":    strconv.Itoa(i),
+			})
+		}
+		return map[string]interface{}{"status": StatusSuccess, "data": data}
+	})
+	defer stop()
+
+	results, err := c.BatchFileSearch(paths, []string{"eng"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if calls != 1 || len(results) != len(paths) {
+		t.Fatalf("Expected %d results in 1 call, got %d in %d", len(paths), len(results), calls)
+	}
+	for i, r := range results {
+		if r.Path != paths[i] {
+			t.Fatalf("Expected result %d for %s, got %s", i, paths[i], r.Path)
+		}
+		name := filepath.Base(r.Path)
+		if name == "small.avi" || name == "missing.avi" {
+			if r.Err == nil || len(r.Subtitles) != 0 {
+				t.Fatalf("Expected an error for %s, got %+v", name, r)
+			}
+			continue
+		}
+		file, _ := os.Open(r.Path)
+		hash, _ := HashFile(file)
+		file.Close()
+		if r.Err != nil || len(r.Subtitles) != 1 || r.Subtitles[0].IDSubtitleFile != hashString(hash) {
+			t.Fatalf("Expected subtitle %s for %s, got %+v", hashString(hash), name, r)
+		}
+	}
+}
+
+// A fake DownloadSubtitles handler: it answers in reverse order, fails
+// batches with ID 13, and has no file for ID 404.
+func downloadHandler(t *testing.T, calls *[][]int) func(string, []byte) interface{} {
+	return func(method string, body []byte) interface{} {
+		if method != "DownloadSubtitles" {
+			t.Errorf("Unexpected call to %s", method)
+		}
+		ids := []int{}
+		requestParam(t, body, 1, &ids)
+		*calls = append(*calls, ids)
+
+		data := []map[string]string{}
+		for i := len(ids) - 1; i >= 0; i-- {
+			switch ids[i] {
+			case 13:
+				return map[string]interface{}{"status": "402 Subtitles has invalid format"}
+			case 404:
+				continue
+			}
+			sf := newTestSubtitleFile([]byte("sub " + strconv.Itoa(ids[i])))
+			data = append(data, map[string]string{
+				"idsubtitlefile": strconv.Itoa(ids[i]),
+				"data":           sf.Data,
+			})
+		}
+		return map[string]interface{}{"status": StatusSuccess, "data": data}
+	}
+}
+
+func TestBatchDownload(t *testing.T) {
+	calls := [][]int{}
+	c, done := newTestServer(t, downloadHandler(t, &calls))
+	defer done()
+
+	ids := make([]int, DownloadBatchSize+2)
+	for i := range ids {
+		ids[i] = 100 + i
+	}
+	ids[3] = 404
+	results := c.BatchDownload(ids)
+
+	if len(calls) != 2 || len(calls[0]) != DownloadBatchSize || len(calls[1]) != 2 {
+		t.Fatalf("Expected batches of %d and 2 IDs, got %v", DownloadBatchSize, calls)
+	}
+	for i, r := range results {
+		if r.ID != ids[i] {
+			t.Fatalf("Expected result %d for ID %d, got %d", i, ids[i], r.ID)
+		}
+		if ids[i] == 404 {
+			if r.Err != ErrNoSubtitleFile {
+				t.Fatalf("Expected ErrNoSubtitleFile for 404, got %v", r.Err)
+			}
+			continue
+		}
+		if r.Err != nil {
+			t.Fatalf("Unexpected error for ID %d: %s", r.ID, r.Err)
+		}
+		if text, _ := r.File.Text(); text != "sub "+strconv.Itoa(ids[i]) {
+			t.Fatalf("Expected file of ID %d, got %q", ids[i], text)
+		}
+	}
+}
+
+func TestBatchDownloadBadID(t *testing.T) {
+	calls := [][]int{}
+	c, done := newTestServer(t, downloadHandler(t, &calls))
+	defer done()
+
+	results := c.BatchDownload([]int{1, 13, 2})
+	if len(calls) != 4 {
+		t.Fatalf("Expected a batch, then 3 single calls, got %v", calls)
+	}
+	for _, r := range results {
+		if r.ID == 13 && r.Err == nil {
+			t.Fatalf("Expected an error for ID 13")
+		}
+		if r.ID != 13 && r.Err != nil {
+			t.Fatalf("Unexpected error for ID %d: %s", r.ID, r.Err)
+		}
+	}
+
+	files, err := c.DownloadSubtitlesByIds([]int{1, 13, 2})
+	if err == nil || len(files) != 2 || files[0].ID != "1" || files[1].ID != "2" {
+		t.Fatalf("Expected files 1 and 2 with an error, got %v, %v", files, err)
+	}
+}
+
+func TestBatchDownloadSubtitles(t *testing.T) {
+	calls := [][]int{}
+	c, done := newTestServer(t, downloadHandler(t, &calls))
+	defer done()
+
+	subs := Subtitles{
+		{IDSubtitleFile: "1", SubEncoding: "UTF-8"},
+		{IDSubtitleFile: "oops"},
+		{IDSubtitleFile: "2", SubEncoding: "CP1252"},
+	}
+	results := c.BatchDownloadSubtitles(subs)
+	if len(results) != 3 {
+		t.Fatalf("Expected 3 results, got %d", len(results))
+	}
+	if results[1].Err == nil {
+		t.Fatalf("Expected an error for a malformed ID")
+	}
+	for _, i := range []int{0, 2} {
+		r := results[i]
+		if r.Err != nil || r.File.ID != subs[i].IDSubtitleFile {
+			t.Fatalf("Expected file %s, got %v", subs[i].IDSubtitleFile, r)
+		}
+		if r.File.Encoding == nil {
+			t.Fatalf("Expected an encoding for file %s", r.File.ID)
+		}
+	}
+}
@@ -1,12 +1,14 @@
 package osdb
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"io"
 	"os"
-	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"golang.org/x/text/encoding"
 	"golang.org/x/text/encoding/htmlindex"
@@ -35,6 +37,22 @@ type Client struct {
 	Login     string
 	Password  string
 	Language  string
+
+	// Maximum number of API calls per RatePeriod, 0 for no limit.
+	RateLimit  int
+	RatePeriod time.Duration
+	limiter    *rateLimiter
+
+	// Optional cache for the hashes of searched files.
+	HashCache *HashCache
+
+	// Optional cache for search results and subtitle files.
+	Cache *ResponseCache
+
+	mu               sync.Mutex
+	downloads        int // files downloaded in this session
+	downloadsChecked int // downloads at the last Quota call
+
 	*xmlrpc.Client
 }
 
@@ -125,6 +143,43 @@ func (c *Client) IMDBSearchByIDFiltered(imdbCode string, isMovie bool, season ui
 	}
 }
 
+// TextSearch searches subtitles with a free-text query, such as a movie
+// title, or a release name. Leave season and episode at 0 unless
+// looking for a TV episode.
+func (c *Client) TextSearch(query string, season uint, episode uint, langs []string) (Subtitles, error) {
+	if strings.TrimSpace(query) == "" {
+		return nil, errors.New("called OS text search with an empty query")
+	}
+	if season == 0 && episode == 0 {
+		params := []interface{}{
+			c.Token,
+			[]struct {
+				Query string `xmlrpc:"query"`
+				Langs string `xmlrpc:"sublanguageid"`
+			}{{
+				query,
+				strings.Join(langs, ","),
+			}},
+		}
+		return c.SearchSubtitles(&params)
+	}
+	params := []interface{}{
+		c.Token,
+		[]struct {
+			Query   string `xmlrpc:"query"`
+			Langs   string `xmlrpc:"sublanguageid"`
+			Season  int64  `xmlrpc:"season"`
+			Episode int64  `xmlrpc:"episode"`
+		}{{
+			query,
+			strings.Join(langs, ","),
+			int64(season),
+			int64(episode),
+		}},
+	}
+	return c.SearchSubtitles(&params)
+}
+
 // HashSearch Searches for subtitles that match a specific hash/size/language combination.
 // This function does not require the path of the movie file, just the hash/size values.
 func (c *Client) HashSearch(hash uint64, size int64, langs []string) (Subtitles, error) {
@@ -149,8 +204,14 @@ func (c *Client) HashSearch(hash uint64, size int64, langs []string) (Subtitles,
 	return c.SearchSubtitles(&params)
 }
 
-// SearchSubtitles searches OSDB with your own parameters.
+// SearchSubtitles searches OSDB with your own parameters. The first
+// one must be the session token: results are cached by the others.
 func (c *Client) SearchSubtitles(params *[]interface{}) (Subtitles, error) {
+	criteria := (*params)[1:] // without the token
+	if subs, ok := c.Cache.search(criteria); ok {
+		return subs, nil
+	}
+
 	res := struct {
 		Data Subtitles `xmlrpc:"data"`
 	}{}
@@ -159,7 +220,9 @@ func (c *Client) SearchSubtitles(params *[]interface{}) (Subtitles, error) {
 		if strings.Contains(err.Error(), "type mismatch") {
 			return nil, err
 		}
+		return res.Data, nil
 	}
+	c.Cache.putSearch(criteria, res.Data)
 	return res.Data, nil
 }
 
@@ -258,49 +321,39 @@ func (c *Client) GetIMDBMovieDetails(id string) (*Movie, error) {
 	return &res.Data, nil
 }
 
-// DownloadSubtitlesByIds downloads subtitles by ID.
+// DownloadSubtitlesByIds downloads subtitles by ID. Files are returned
+// in the order of ids, without the IDs that have no file. When some
+// downloads fail, the other files are returned along with the first
+// error: see BatchDownload for per-ID results.
 func (c *Client) DownloadSubtitlesByIds(ids []int) ([]SubtitleFile, error) {
-	params := []interface{}{c.Token, ids}
-	res := struct {
-		Status string         `xmlrpc:"status"`
-		Data   []SubtitleFile `xmlrpc:"data"`
-	}{}
-	if err := c.Call("DownloadSubtitles", params, &res); err != nil {
-		return nil, err
-	}
-	if res.Status != StatusSuccess {
-		return nil, fmt.Errorf("DownloadSubtitles error: %s", res.Status)
+	files := []SubtitleFile{}
+	var err error
+	for _, r := range c.BatchDownload(ids) {
+		switch {
+		case r.Err == nil:
+			files = append(files, *r.File)
+		case r.Err != ErrNoSubtitleFile && err == nil:
+			err = r.Err
+		}
 	}
-	return res.Data, nil
+	return files, err
 }
 
-// DownloadSubtitles downloads subtitles in bulk.
+// DownloadSubtitles downloads subtitles in bulk. Files are returned in
+// the order of subtitles, decoded with their encoding. When some
+// downloads fail, the other files are returned along with the first
+// error: see BatchDownloadSubtitles for per-subtitle results.
 func (c *Client) DownloadSubtitles(subtitles Subtitles) ([]SubtitleFile, error) {
-	ids := make([]int, len(subtitles))
-	for i := range subtitles {
-		id, err := strconv.Atoi(subtitles[i].IDSubtitleFile)
-		if err != nil {
-			return nil, fmt.Errorf("malformed subtitle ID: %s", err)
-		}
-		ids[i] = id
-	}
-
-	subtitleFiles, err := c.DownloadSubtitlesByIds(ids)
-	if err != nil {
-		return nil, err
-	}
-
-	for i := range subtitleFiles {
-		encodingName := subtitles[i].SubEncoding
-		if encodingName != "" {
-			subtitleFiles[i].Encoding, err = encodingFromName(subtitles[i].SubEncoding)
-			if err != nil {
-				return nil, err
-			}
+	files := []SubtitleFile{}
+	var err error
+	for _, r := range c.BatchDownloadSubtitles(subtitles) {
+		if r.Err == nil {
+			files = append(files, *r.File)
+		} else if err == nil {
+			err = r.Err
 		}
 	}
-
-	return subtitleFiles, nil
+	return files, err
 }
 
 // Download saves a subtitle file to disk, using the OSDB specified name.
@@ -308,8 +361,14 @@ func (c *Client) Download(s *Subtitle) error {
 	return c.DownloadTo(s, s.SubFileName)
 }
 
-// DownloadTo saves a subtitle file to the specified path.
-func (c *Client) DownloadTo(s *Subtitle, path string) (err error) {
+// DownloadTo saves a subtitle file to the specified path. Optional
+// SaveOptions control the encoding, BOM and line endings of the file.
+func (c *Client) DownloadTo(s *Subtitle, path string, opts ...SaveOptions) (err error) {
+	var opt SaveOptions
+	if len(opts) > 0 {
+		opt = opts[0]
+	}
+
 	// Download
 	files, err := c.DownloadSubtitles(Subtitles{*s})
 	if err != nil {
@@ -319,20 +378,30 @@ func (c *Client) DownloadTo(s *Subtitle, path string) (err error) {
 		return fmt.Errorf("No file match this subtitle ID")
 	}
 
-	// Save to disk.
+	// Encode before touching the disk, so that unmappable characters
+	// leave no half-written file behind.
 	r, err := files[0].Reader()
 	if err != nil {
 		return
 	}
 	defer r.Close()
+	buf := new(bytes.Buffer)
+	if err = opt.Save(buf, r); err != nil {
+		if _, ok := err.(*UnmappableError); !ok || !opt.Substitute {
+			return
+		}
+	}
 
-	w, err := os.Create(path)
-	if err != nil {
-		return
+	// Save to disk.
+	w, err2 := os.Create(path)
+	if err2 != nil {
+		return err2
 	}
 	defer w.Close()
 
-	_, err = io.Copy(w, r)
+	if _, err2 = io.Copy(w, buf); err2 != nil {
+		return err2
+	}
 	return
 }
 
@@ -445,7 +514,7 @@ func (c *Client) fileToSearchParams(path string, langs []string) (*[]interface{}
 	size := fi.Size()
 
 	// File hash
-	h, err := HashFile(file)
+	h, err := c.HashCache.HashFile(file)
 	if err != nil {
 		return nil, err
 	}
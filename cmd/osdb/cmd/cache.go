@@ -0,0 +1,178 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/oz/osdb"
+	"github.com/spf13/cobra"
+)
+
+var (
+	paramHashCache = defaultHashCache()
+	paramMaxAge    time.Duration
+	paramCache     bool
+	paramCacheTTL  = osdb.DefaultSearchTTL
+	paramClearOnly string
+
+	hashCache     *osdb.HashCache
+	hashCacheOnce sync.Once
+)
+
+func init() {
+	RootCmd.PersistentFlags().StringVar(&paramHashCache, "hash-cache", paramHashCache, "Keep movie hashes in this file, empty to disable")
+	RootCmd.PersistentFlags().BoolVar(&paramCache, "cache", paramCache, "Cache search results and subtitle files, see osdb cache")
+	RootCmd.PersistentFlags().DurationVar(&paramCacheTTL, "cache-ttl", paramCacheTTL, "How long search results, even empty ones, are cached")
+	cachePruneCmd.Flags().DurationVar(&paramMaxAge, "max-age", 0, "Also remove hashes unused for this long, e.g. 720h")
+	cacheClearCmd.Flags().StringVar(&paramClearOnly, "only", "", "Only clear searches, expired (searches) or files")
+	cacheCmd.AddCommand(cachePruneCmd, cacheInfoCmd, cacheClearCmd)
+	RootCmd.AddCommand(cacheCmd)
+}
+
+func defaultHashCache() string {
+	if dir := cacheDir(); dir != "" {
+		return filepath.Join(dir, "hashes.json")
+	}
+	return ""
+}
+
+func responseCacheDir() string {
+	if dir := cacheDir(); dir != "" {
+		return filepath.Join(dir, "responses")
+	}
+	return ""
+}
+
+// The cache of OSDB responses, nil unless enabled with --cache. Dry
+// runs read it, but don't write to it.
+func responseCache() *osdb.ResponseCache {
+	dir := responseCacheDir()
+	if !paramCache || dir == "" {
+		return nil
+	}
+	rc := osdb.NewResponseCache(dir, paramCacheTTL)
+	rc.ReadOnly = paramDryRun
+	return rc
+}
+
+// The hash cache, opened on first use. It is nil when disabled, or when
+// it can't be read: files are then hashed every time.
+func getHashCache() *osdb.HashCache {
+	hashCacheOnce.Do(func() {
+		if paramHashCache == "" {
+			return
+		}
+		c, err := osdb.OpenHashCache(paramHashCache)
+		if err != nil {
+			logf("Warning: hash cache disabled: %s\n", err)
+			return
+		}
+		hashCache = c
+	})
+	return hashCache
+}
+
+// Write the hash cache back, if it was used, unless this is a dry run,
+// which writes nothing to disk.
+func saveHashCache() {
+	if paramDryRun {
+		return
+	}
+	if err := hashCache.Save(); err != nil {
+		logf("Warning: can't save hash cache: %s\n", err)
+	}
+}
+
+var cacheCmd = &cobra.Command{
+	Use:   "cache",
+	Short: "Manage cached data",
+	Long: `Manage the data osdb keeps between runs: the hashes of movie
+files, so that they are not read again, and OSDB search results and
+subtitle files, so that the same calls are not sent again.`,
+}
+
+var cachePruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Remove cached hashes of files that are gone or changed",
+	PreRun: func(cmd *cobra.Command, args []string) {
+		if paramHashCache == "" {
+			fmt.Println("Hash cache is disabled.")
+			os.Exit(1)
+		}
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		c := getHashCache()
+		if c == nil {
+			os.Exit(ExitFailure)
+		}
+		removed := c.Prune(paramMaxAge)
+		if err := c.Save(); err != nil {
+			fmt.Printf("Error: %s\n", err)
+			os.Exit(ExitFailure)
+		}
+		fmt.Printf("Removed %d hashes, %d left.\n", removed, c.Len())
+	},
+}
+
+var cacheInfoCmd = &cobra.Command{
+	Use:   "info",
+	Short: "Show what is cached",
+	Run: func(cmd *cobra.Command, args []string) {
+		if c := getHashCache(); c != nil {
+			fmt.Printf("Hashes: %d, in %s\n", c.Len(), paramHashCache)
+		} else {
+			fmt.Println("Hashes: disabled")
+		}
+		if responseCacheDir() == "" {
+			fmt.Println("Responses: no cache directory")
+			return
+		}
+		rc := osdb.NewResponseCache(responseCacheDir(), paramCacheTTL)
+		stats, err := rc.Stats()
+		if err != nil {
+			fmt.Printf("Error: %s\n", err)
+			os.Exit(ExitFailure)
+		}
+		fmt.Printf("Responses: %d searches (%d expired), %d subtitle files, %d KiB, in %s\n",
+			stats.Searches, stats.Expired, stats.Files, (stats.Size+1023)/1024, rc.Dir)
+		if !paramCache {
+			fmt.Println("Responses are only cached with --cache.")
+		}
+	},
+}
+
+var cacheClearCmd = &cobra.Command{
+	Use:   "clear",
+	Short: "Remove cached search results and subtitle files",
+	PreRun: func(cmd *cobra.Command, args []string) {
+		switch paramClearOnly {
+		case "", "searches", "expired", "files":
+		default:
+			fmt.Printf("Invalid --only value %q.\n", paramClearOnly)
+			os.Exit(1)
+		}
+		if responseCacheDir() == "" {
+			fmt.Println("No cache directory.")
+			os.Exit(1)
+		}
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		rc := osdb.NewResponseCache(responseCacheDir(), paramCacheTTL)
+		searches, files := 0, 0
+		var err error
+		if paramClearOnly != "files" {
+			searches, err = rc.ClearSearches(paramClearOnly == "expired")
+		}
+		if err == nil && (paramClearOnly == "" || paramClearOnly == "files") {
+			files, err = rc.ClearFiles()
+		}
+		if err != nil {
+			fmt.Printf("Error: %s\n", err)
+			os.Exit(ExitFailure)
+		}
+		fmt.Printf("Removed %d searches and %d subtitle files.\n", searches, files)
+	},
+}
@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/oz/osdb"
+	"github.com/spf13/cobra"
+)
+
+var paramCheckHI bool
+
+func init() {
+	cleanCmd.Flags().BoolVarP(&paramCheckHI, "check", "c", false, "Only tell whether files are hearing-impaired subtitles")
+	RootCmd.AddCommand(cleanCmd)
+}
+
+var cleanCmd = &cobra.Command{
+	Use:   "clean [sub_files...]",
+	Short: "Remove hearing-impaired annotations from subtitles",
+	Long: `Remove sound descriptions, song lyrics and speaker labels from
+subtitle files, and the cues left empty afterwards. Files are rewritten
+in place, as UTF-8, in their own format: SRT or WebVTT.
+
+Exits with status 1 when a file can't be cleaned.`,
+	PreRun: func(cmd *cobra.Command, args []string) {
+		if len(args) < 1 {
+			fmt.Println("Missing subtitle files.")
+			os.Exit(1)
+		}
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		failed := false
+		for _, file := range args {
+			if err := cleanSubs(file); err != nil {
+				fmt.Printf("Error: %s: %s\n", file, err)
+				failed = true
+			}
+		}
+		if failed {
+			os.Exit(ExitFailure)
+		}
+	},
+}
+
+func cleanSubs(file string) error {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	doc, err := osdb.ParseBytes(data)
+	if err != nil {
+		return err
+	}
+
+	if paramCheckHI {
+		hi := "not hearing-impaired"
+		if osdb.DetectHearingImpaired(doc) {
+			hi = "hearing-impaired"
+		}
+		fmt.Printf("%s: %s (%.0f%% annotated cues)\n",
+			file, hi, doc.HearingImpairedRatio()*100)
+		return nil
+	}
+
+	clean := doc.StripHearingImpaired()
+	fmt.Printf("- Cleaned %s: %d cues removed\n", file, len(doc.Cues)-len(clean.Cues))
+	buf := new(bytes.Buffer)
+	clean.Write(buf)
+	return ioutil.WriteFile(file, buf.Bytes(), 0644)
+}
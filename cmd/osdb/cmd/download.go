@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/oz/osdb"
+	"github.com/spf13/cobra"
+)
+
+var (
+	paramDownloadDir    string
+	paramDownloadFormat string
+)
+
+func init() {
+	downloadCmd.Flags().StringVarP(&paramDownloadDir, "dir", "d", ".", "Save subtitles in this directory")
+	downloadCmd.Flags().StringVar(&paramDownloadFormat, "format", "", "Subtitle format extension, e.g. srt, instead of guessing it")
+	RootCmd.AddCommand(downloadCmd)
+}
+
+var downloadCmd = &cobra.Command{
+	Use:   "download [IDSubtitleFile...]",
+	Short: "Download subtitles by ID",
+	Long: `Download subtitle files by their IDs, as listed by "osdb search", and
+save them as <ID>.<format>. OSDB doesn't send the format of downloaded
+files: it is guessed from their contents, e.g. srt, vtt or ass, unless
+given with --format, e.g. from the FORMAT column of "osdb search".
+Files are saved as stored on OSDB, without re-encoding.`,
+	PreRun: func(cmd *cobra.Command, args []string) {
+		if len(args) < 1 {
+			fail(errors.New("missing subtitle IDs"))
+		}
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		ids := make([]int, len(args))
+		for i, arg := range args {
+			id, err := strconv.Atoi(arg)
+			if err != nil {
+				fail(fmt.Errorf("invalid subtitle ID %q", arg))
+			}
+			ids[i] = id
+		}
+
+		client, err := InitClient(paramLangs[0])
+		if err != nil {
+			fail(err)
+		}
+
+		results := newSummary()
+		for i, r := range client.BatchDownload(ids) {
+			res := fileResult{File: args[i]}
+			switch r.Err {
+			case nil:
+				results.add(res, saveRawSubtitleFile(r.File, &res))
+			case osdb.ErrNoSubtitleFile:
+				results.add(res, NoSub)
+			default:
+				results.add(res, reportGetError(r.Err))
+			}
+		}
+		results.print()
+		os.Exit(results.exitCode())
+	},
+}
+
+func saveRawSubtitleFile(sf *osdb.SubtitleFile, res *fileResult) error {
+	raw, err := sf.Raw()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(paramDownloadDir, 0755); err != nil {
+		return err
+	}
+	format := paramDownloadFormat
+	if format == "" {
+		if format, err = sf.Format(); err != nil {
+			return err
+		}
+	}
+	dest := filepath.Join(paramDownloadDir, sf.ID+"."+strings.TrimPrefix(format, "."))
+	logf("- Downloading %s to: %s\n", sf.ID, dest)
+	if err := ioutil.WriteFile(dest, raw, 0644); err != nil {
+		return err
+	}
+	res.saved(sf.ID, dest)
+	return nil
+}
@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/oz/osdb"
+)
+
+// Build a SubtitleFile, as returned by OSDB, from raw file contents.
+func newTestSubtitleFile(id string, raw string) *osdb.SubtitleFile {
+	buf := new(bytes.Buffer)
+	enc := base64.NewEncoder(base64.StdEncoding, buf)
+	gz := gzip.NewWriter(enc)
+	gz.Write([]byte(raw))
+	gz.Close()
+	enc.Close()
+	return &osdb.SubtitleFile{ID: id, Data: buf.String()}
+}
+
+func TestSaveRawSubtitleFile(t *testing.T) {
+	dir, done := tempDir(t)
+	defer done()
+	defer func(dir, format string) { paramDownloadDir, paramDownloadFormat = dir, format }(paramDownloadDir, paramDownloadFormat)
+	paramDownloadDir = dir
+	// A directory stands in the way of 3.srt.
+	os.Mkdir(filepath.Join(dir, "3.srt"), 0755)
+
+	const srt = "1\n00:00:01,000 --> 00:00:02,000\nHello\n"
+	for _, tt := range []struct {
+		name   string
+		file   *osdb.SubtitleFile
+		format string
+		path   string // saved, if any
+	}{
+		{"srt", newTestSubtitleFile("1", srt), "", "1.srt"},
+		{"vtt", newTestSubtitleFile("2", "WEBVTT\n\n00:01.000 --> 00:02.000\nHello\n"), "", "2.vtt"},
+		{"format", newTestSubtitleFile("4", srt), ".sub", "4.sub"},
+		{"write error", newTestSubtitleFile("3", srt), "", ""},
+	} {
+		paramDownloadFormat = tt.format
+		res := fileResult{File: tt.file.ID}
+		err := saveRawSubtitleFile(tt.file, &res)
+		if tt.path == "" {
+			if err == nil || len(res.Paths) != 0 || len(res.SubtitleIDs) != 0 {
+				t.Errorf("%s: expected an error, and no saved file, got %v, %+v", tt.name, err, res)
+			}
+			continue
+		}
+		path := filepath.Join(dir, tt.path)
+		if err != nil || len(res.Paths) != 1 || res.Paths[0] != path {
+			t.Errorf("%s: expected %s, got %v, %+v", tt.name, path, err, res)
+			continue
+		}
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+		}
+	}
+}
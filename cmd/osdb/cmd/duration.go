@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/oz/osdb"
+)
+
+// Parse a comma-separated list of times, either as Go durations such as
+// "52m10s", or as subtitle timestamps such as "00:52:10,000".
+func parseTimes(list string) ([]time.Duration, error) {
+	times := []time.Duration{}
+	for _, s := range splitTimes(list) {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			if d, err = osdb.ParseTimestamp(s); err != nil {
+				return nil, fmt.Errorf("invalid time %q, expected e.g. 52m10s or 00:52:10,000", s)
+			}
+		}
+		times = append(times, d)
+	}
+	return times, nil
+}
+
+// Split a list of times on commas, except the decimal commas of SRT
+// timestamps: those following "hh:mm:ss", and followed by a digit.
+func splitTimes(list string) []string {
+	items := []string{}
+	start := 0
+	for i := 0; i < len(list); i++ {
+		if list[i] != ',' {
+			continue
+		}
+		item := list[start:i]
+		decimal := strings.Contains(item, ":") && !strings.Contains(item, ",") &&
+			i+1 < len(list) && list[i+1] >= '0' && list[i+1] <= '9'
+		if !decimal {
+			items = append(items, item)
+			start = i + 1
+		}
+	}
+	return append(items, list[start:])
+}
+
+// Find the durations of video files with ffprobe.
+func videoDurations(files []string) ([]time.Duration, error) {
+	durations := make([]time.Duration, len(files))
+	for i, file := range files {
+		out, err := exec.Command(
+			"ffprobe", "-v", "error",
+			"-show_entries", "format=duration",
+			"-of", "default=noprint_wrappers=1:nokey=1",
+			file,
+		).Output()
+		if err != nil {
+			return nil, fmt.Errorf("can't find duration of %s with ffprobe: %s", file, err)
+		}
+		secs, err := strconv.ParseFloat(strings.TrimSpace(string(out)), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ffprobe duration for %s: %q", file, out)
+		}
+		durations[i] = time.Duration(secs * float64(time.Second))
+	}
+	return durations, nil
+}
@@ -0,0 +1,39 @@
+package cmd
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseTimes(t *testing.T) {
+	const (
+		srt = 52*time.Minute + 10*time.Second
+		ms  = 500 * time.Millisecond
+	)
+	for _, tt := range []struct {
+		list  string
+		times []time.Duration
+		ok    bool
+	}{
+		{"", []time.Duration{}, true},
+		{"52m10s", []time.Duration{srt}, true},
+		{"52m10s, 1h", []time.Duration{srt, time.Hour}, true},
+		{"00:52:10,000", []time.Duration{srt}, true},
+		{"00:52:10.500", []time.Duration{srt + ms}, true},
+		{"00:52:10,000,01:00:00,500", []time.Duration{srt, time.Hour + ms}, true},
+		{"00:52:10,000, 52m10s,1h", []time.Duration{srt, srt, time.Hour}, true},
+		{"00:52:10,100s", nil, false},
+		{"52m10s,000", nil, false},
+		{"soon", nil, false},
+	} {
+		times, err := parseTimes(tt.list)
+		if (err == nil) != tt.ok {
+			t.Errorf("%q: expected ok %v, got error %v", tt.list, tt.ok, err)
+			continue
+		}
+		if tt.ok && !reflect.DeepEqual(times, tt.times) {
+			t.Errorf("%q: expected %v, got %v", tt.list, tt.times, times)
+		}
+	}
+}
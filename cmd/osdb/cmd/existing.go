@@ -0,0 +1,117 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Backup policies, for --backup.
+const (
+	BackupNone     = ""
+	BackupSimple   = "simple"   // keep a single movie.en.srt.bak
+	BackupNumbered = "numbered" // keep movie.en.srt.~1~, movie.en.srt.~2~, etc.
+)
+
+var (
+	paramSkipExisting = true
+	paramForce        bool
+	paramBackup       string
+)
+
+// Extensions of subtitle files that count as existing subtitles.
+var subtitleExts = map[string]bool{
+	".srt": true, ".ass": true, ".ssa": true, ".sub": true, ".vtt": true,
+}
+
+// Whether existing subtitles are left alone.
+func skipExisting() bool {
+	return paramSkipExisting && !paramForce && paramBackup == BackupNone
+}
+
+// Find an existing subtitle for a video in a language, tagged like
+// "movie.en.srt", "movie.eng.hi.ass", etc., either next to the video,
+// or in --output-dir.
+func existingSubtitle(video string, lang string) string {
+	video = localVideo(video)
+	dir := filepath.Dir(video)
+	if paramOutputDir != "" {
+		dir = paramOutputDir
+	}
+	base := strings.TrimSuffix(filepath.Base(video), filepath.Ext(video))
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return ""
+	}
+
+	tags := languageTags(lang)
+	for _, e := range entries {
+		name := e.Name()
+		ext := strings.ToLower(filepath.Ext(name))
+		if e.IsDir() || !subtitleExts[ext] || !strings.HasPrefix(name, base+".") {
+			continue
+		}
+		// The language is the tag right after the base name, before
+		// flags such as "hi" or "forced": "movie.en.hi.srt" is English,
+		// and "movie.cd2.en.srt" or "movie.extended.en.srt" belong to
+		// other videos.
+		tag := strings.SplitN(strings.TrimSuffix(name[len(base)+1:], ext), ".", 2)[0]
+		for _, t := range tags {
+			if strings.EqualFold(tag, t) {
+				return filepath.Join(dir, name)
+			}
+		}
+	}
+	return ""
+}
+
+// Check whether a subtitle may be saved to dest, before downloading it.
+func checkDest(dest string) error {
+	if _, err := os.Stat(dest); err == nil && skipExisting() {
+		return &skipError{fmt.Sprintf("%s already exists", dest)}
+	}
+	return nil
+}
+
+// Keep a backup of dest before overwriting it, following --backup.
+func backupDest(dest string) error {
+	if paramBackup == BackupNone {
+		return nil
+	}
+	if _, err := os.Stat(dest); os.IsNotExist(err) {
+		return nil
+	}
+
+	backup := dest + ".bak"
+	if paramBackup == BackupNumbered {
+		backup = fmt.Sprintf("%s.~%d~", dest, lastBackup(dest)+1)
+	}
+	logf("- Backing up %s to %s\n", dest, backup)
+	return os.Rename(dest, backup)
+}
+
+// Number of the latest numbered backup of dest, e.g. 2 for
+// "movie.en.srt.~2~", or 0 when there is none. New backups are numbered
+// after it, even when older ones were removed.
+func lastBackup(dest string) int {
+	backups, _ := filepath.Glob(escapeGlob(dest) + ".~*~")
+	last := 0
+	for _, b := range backups {
+		n, err := strconv.Atoi(strings.TrimSuffix(b[len(dest)+2:], "~"))
+		if err == nil && n > last {
+			last = n
+		}
+	}
+	return last
+}
+
+var globMetaRe = regexp.MustCompile(`[*?\[\\]`)
+
+// Escape the glob meta-characters of a path, such as "[" in file names.
+func escapeGlob(path string) string {
+	return globMetaRe.ReplaceAllString(path, `\$0`)
+}
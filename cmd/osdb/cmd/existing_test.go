@@ -0,0 +1,107 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestBackupDest(t *testing.T) {
+	defer func(backup string) { paramBackup = backup }(paramBackup)
+
+	for _, tt := range []struct {
+		name     string
+		backup   string
+		existing []string // files before the backup
+		files    []string // files after it
+	}{
+		{"none", BackupNone, []string{"movie.en.srt"}, []string{"movie.en.srt"}},
+		{"missing dest", BackupSimple, nil, []string{}},
+		{"simple", BackupSimple, []string{"movie.en.srt"}, []string{"movie.en.srt.bak"}},
+		{"simple again", BackupSimple, []string{"movie.en.srt", "movie.en.srt.bak"}, []string{"movie.en.srt.bak"}},
+		{"numbered", BackupNumbered, []string{"movie.en.srt"}, []string{"movie.en.srt.~1~"}},
+		{"numbered, not a number", BackupNumbered, []string{"movie.en.srt", "movie.en.srt.~x~"}, []string{"movie.en.srt.~1~", "movie.en.srt.~x~"}},
+		{
+			"numbered again",
+			BackupNumbered,
+			[]string{"movie.en.srt", "movie.en.srt.~1~", "movie.en.srt.~2~"},
+			[]string{"movie.en.srt.~1~", "movie.en.srt.~2~", "movie.en.srt.~3~"},
+		},
+		{
+			"numbered gap",
+			BackupNumbered,
+			[]string{"movie.en.srt", "movie.en.srt.~2~"},
+			[]string{"movie.en.srt.~2~", "movie.en.srt.~3~"},
+		},
+	} {
+		func() {
+			dir, done := tempDir(t)
+			defer done()
+			for _, name := range tt.existing {
+				ioutil.WriteFile(filepath.Join(dir, name), []byte(name), 0644)
+			}
+			paramBackup = tt.backup
+
+			if err := backupDest(filepath.Join(dir, "movie.en.srt")); err != nil {
+				t.Errorf("%s: unexpected error: %s", tt.name, err)
+				return
+			}
+			files := []string{}
+			entries, _ := ioutil.ReadDir(dir)
+			for _, e := range entries {
+				files = append(files, e.Name())
+			}
+			sort.Strings(files)
+			if !reflect.DeepEqual(files, tt.files) {
+				t.Errorf("%s: expected %v, got %v", tt.name, tt.files, files)
+			}
+			if len(tt.existing) > 0 && tt.backup != BackupNone {
+				// The new backup holds the overwritten subtitle.
+				for _, name := range files {
+					data, _ := ioutil.ReadFile(filepath.Join(dir, name))
+					if string(data) == "movie.en.srt" {
+						return
+					}
+				}
+				t.Errorf("%s: expected a backup of the subtitle", tt.name)
+			}
+		}()
+	}
+}
+
+func TestExistingSubtitle(t *testing.T) {
+	dir, done := tempDir(t)
+	defer done()
+	for _, name := range []string{
+		"movie.avi", "movie.en.hi.srt", "movie.fre.ass", "movie.de.txt", "other.es.srt",
+		"movie.extended.pt.srt", "movie.cd2.nl.srt", "movie.forced.srt",
+	} {
+		ioutil.WriteFile(filepath.Join(dir, name), nil, 0644)
+	}
+	os.Mkdir(filepath.Join(dir, "movie.it.srt"), 0755)
+
+	for _, tt := range []struct {
+		lang     string
+		existing string
+	}{
+		{"eng", "movie.en.hi.srt"},
+		{"fre", "movie.fre.ass"},
+		{"ger", ""}, // not a subtitle extension
+		{"spa", ""}, // another video
+		{"ita", ""}, // a directory
+		{"hin", ""}, // the hearing-impaired flag
+		{"por", ""}, // another cut
+		{"dut", ""}, // another part
+	} {
+		existing := existingSubtitle(filepath.Join(dir, "movie.avi"), tt.lang)
+		if tt.existing != "" {
+			tt.existing = filepath.Join(dir, tt.existing)
+		}
+		if existing != tt.existing {
+			t.Errorf("%s: expected %q, got %q", tt.lang, tt.existing, existing)
+		}
+	}
+}
@@ -1,84 +1,519 @@
 package cmd
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path"
+	"strings"
+	"time"
 
-	"github.com/h2non/filetype"
 	"github.com/oz/osdb"
 	"github.com/spf13/cobra"
 )
 
 var NoSub = errors.New("No subtitles found!")
 
+// Video parts whose subtitles were saved along with another part's,
+// see partKey.
+var doneParts = map[string]bool{}
+
+var (
+	paramEncoding   string
+	paramBOM        string
+	paramEOL        string
+	paramSubstitute bool
+	paramStripHI    bool
+	paramMerge      bool
+	paramMergeFmt   string
+	paramDryRun     bool
+
+	saveOpts osdb.SaveOptions
+)
+
 func init() {
 	getCmd.Flags().StringVarP(&paramLang, "lang", "l", GetEnvLang(), "Subtitle language")
+	getCmd.Flags().StringVarP(&paramEncoding, "encoding", "e", "", "Output encoding, e.g. windows-1250 (default UTF-8)")
+	getCmd.Flags().StringVar(&paramBOM, "bom", "keep", "Byte order mark: keep, strip or add")
+	getCmd.Flags().StringVar(&paramEOL, "eol", "keep", "Line endings: keep, lf or crlf")
+	getCmd.Flags().BoolVar(&paramSubstitute, "substitute", false, "Replace characters missing from the output encoding with '?'")
+	getCmd.Flags().BoolVar(&paramStripHI, "strip-hi", false, "Remove hearing-impaired annotations")
+	getCmd.Flags().BoolVar(&paramMerge, "merge", false, "Merge the first two languages into a bilingual subtitle")
+	getCmd.Flags().StringVar(&paramMergeFmt, "merge-format", "srt", "Bilingual subtitle format: srt (stacked) or ass (top/bottom)")
+	getCmd.Flags().StringVar(&paramOutput, "output-template", DefaultOutputTemplate, "Subtitle path template, with {dir}, {base}, {lang2}, {lang3}, {format}, {hi}, {forced} and {release}")
+	getCmd.Flags().StringVar(&paramOutputDir, "output-dir", "", "Save subtitles in this directory, instead of next to videos")
+	getCmd.Flags().BoolVarP(&paramInteractive, "interactive", "i", false, "Pick subtitles among candidates, when stdin is a terminal")
+	getCmd.Flags().BoolVar(&paramSkipExisting, "skip-existing", true, "Skip videos that already have subtitles in a language")
+	getCmd.Flags().BoolVarP(&paramForce, "force", "f", false, "Overwrite existing subtitles, and unfinished journals")
+	getCmd.Flags().StringVar(&paramBackup, "backup", BackupNone, "Back up existing subtitles before overwriting them: simple (.bak), or --backup=numbered (.~1~)")
+	getCmd.Flag("backup").NoOptDefVal = BackupSimple
+	getCmd.Flags().BoolVarP(&scanOpts.recursive, "recursive", "r", false, "Scan directories recursively")
+	getCmd.Flags().IntVar(&scanOpts.maxDepth, "max-depth", 0, "Maximum directory depth with --recursive, 0 for unlimited")
+	getCmd.Flags().StringSliceVar(&scanOpts.include, "include", nil, "Only scan files matching these globs")
+	getCmd.Flags().StringSliceVar(&scanOpts.exclude, "exclude", nil, "Skip files and directories matching these globs")
+	getCmd.Flags().StringVar(&scanOpts.symlinks, "symlinks", SymlinksFiles, "Symbolic links: skip, files or follow")
+	getCmd.Flags().IntVarP(&paramJobs, "jobs", "j", DefaultJobs, "Number of files hashed, searched and downloaded in parallel")
+	getCmd.Flags().BoolVar(&paramProgress, "progress", true, "Show progress, with an ETA, when stderr is a terminal")
+	getCmd.Flags().StringVar(&paramQueue, "queue", "", "When the download quota is used, append the files left to this file")
+	getCmd.Flags().StringVar(&paramFilesFrom, "files-from", "", "Read files to process from this file, one per line")
+	getCmd.Flags().StringSliceVar(&paramFromURL, "from-url", nil, "Also process these remote videos, hashed with HTTP Range requests")
+	getCmd.Flags().StringVar(&paramJournal, "journal", paramJournal, "Record the progress of jobs in this file, empty to disable")
+	getCmd.Flags().BoolVar(&paramResume, "resume", false, "Resume the run recorded in the journal")
+	getCmd.Flags().BoolVarP(&paramDryRun, "dry-run", "n", false, "Search and report the subtitles to get, without downloading or writing them")
 	RootCmd.AddCommand(getCmd)
 }
 
 var getCmd = &cobra.Command{
-	Use:   "get [file/directory]",
+	Use:   "get [files/directories...]",
 	Short: "Get subtitles for a file or for all files in a directory.",
-	Long:  `Download subtitles for a file or for all files in a directory.`,
+	Long: `Download subtitles for a file or for all files in a directory.
+
+Every file is processed for every language, and a summary is printed at
+the end, in the order of files and languages. Files are hashed, searched
+and downloaded in parallel with --jobs, within OSDB's rate limit, then
+subtitles are picked one file after the other. The exit status is 0
+when all subtitles were found, 1 when nothing succeeded, and 2 when some
+subtitles are missing or failed.
+
+Subtitles that already exist in a language are skipped, unless with
+--force, or --backup to keep a .bak copy of them. Numbered copies need
+an equal sign, as in --backup=numbered: a separate word is a file.
+
+OSDB limits downloads per day. Once the quota is used, get stops
+downloading, and with --queue, saves the files left for a later run
+with --files-from.
+
+The progress of each file is appended to a journal, one JSON line per
+state: hashed, searched, picked, downloaded, skipped, missing or failed.
+After an interruption, --resume continues the run where it stopped,
+without arguments, or for the given files, and retries failed files. A
+new run of the same files doesn't overwrite the journal of an
+interrupted one, unless with --force.
+
+Remote videos, given with --from-url, are hashed with HTTP Range
+requests, without downloading them. Their subtitles are saved in the
+current directory, or in --output-dir.
+
+RAR and ZIP archives are accepted as files, when they store their video
+uncompressed: the video is hashed without extracting it. Give the first
+volume of multi-volume RAR archives. Split ZIP archives (.z01, .z02,
+..., .zip) are not supported.
+
+With --dry-run, files are hashed and searched, and the chosen subtitles
+are reported with their destination, but nothing is downloaded or
+written.`,
+	PreRun: func(cmd *cobra.Command, args []string) {
+		opts, err := parseSaveOptions()
+		if err != nil {
+			fail(err)
+		}
+		saveOpts = opts
+		switch paramBackup {
+		case BackupNone, BackupSimple, BackupNumbered:
+		default:
+			fail(fmt.Errorf("invalid --backup value %q", paramBackup))
+		}
+		switch scanOpts.symlinks {
+		case SymlinksSkip, SymlinksFiles, SymlinksFollow:
+		default:
+			fail(fmt.Errorf("invalid --symlinks value %q", scanOpts.symlinks))
+		}
+		for _, u := range paramFromURL {
+			if !isURL(u) {
+				fail(fmt.Errorf("invalid --from-url %q, expected an http(s) URL", u))
+			}
+		}
+		if paramResume && (paramMerge || paramJournal == "") {
+			fail(errors.New("--resume needs a --journal, and doesn't support --merge"))
+		}
+		if paramMerge {
+			if len(paramLangs) != 2 {
+				fail(errors.New("--merge needs two languages, e.g. --lang eng,fra"))
+			}
+			if paramMergeFmt != "srt" && paramMergeFmt != "ass" {
+				fail(fmt.Errorf("invalid --merge-format %q", paramMergeFmt))
+			}
+		}
+	},
 	Run: func(cmd *cobra.Command, args []string) {
-		for _, l := range paramLangs {
-			client, err := InitClient(l)
+		if paramFilesFrom != "" {
+			list, err := readFileList(paramFilesFrom)
 			if err != nil {
-				fmt.Printf("Error: %s\n", err)
+				fail(err)
+			}
+			args = append(args, list...)
+		}
+		args = append(args, paramFromURL...)
+
+		var (
+			files  []string
+			states map[string]journalRecord
+			err    error
+		)
+		if paramResume {
+			var run *journalRun
+			if run, states, err = loadJournal(paramJournal); err != nil {
+				fail(err)
+			}
+			files, paramLangs = run.Files, run.Langs
+			if len(args) > 0 {
+				files, err = expandPaths(args)
 			}
-			if len(args) == 1 {
-				x, err := os.Stat(args[0])
-				if err != nil {
-					fmt.Printf("Error: %s\n", err)
-					break
-				} else if x.IsDir() {
-					args = getFilesFromPath(args[0])
+		} else {
+			files, err = expandPaths(args)
+		}
+		if err != nil {
+			fail(err)
+		}
+		if paramJournal != "" && !paramDryRun && !paramMerge && !paramResume && !paramForce {
+			if err := checkJournal(paramJournal, files); err != nil {
+				fail(err)
+			}
+		}
+		client, err := InitClient(paramLangs[0])
+		if err != nil {
+			fail(err)
+		}
+		if paramJournal != "" && !paramDryRun && !paramMerge {
+			var run *journalRun
+			if !paramResume {
+				run = &journalRun{Files: files, Langs: paramLangs}
+			}
+			if getJournal, err = openJournal(paramJournal, run); err != nil {
+				fail(err)
+			}
+		}
+
+		results := newSummary()
+		left := []string{} // files stopped by the download quota
+		if paramMerge {
+			for _, file := range files {
+				res := fileResult{File: file, Lang: paramLangs[0] + "+" + paramLangs[1]}
+				err := downloadsStopped()
+				if err == nil {
+					err = getMergedSubs(client, file, paramLangs[0], paramLangs[1], &res)
+				}
+				if quotaExceeded(err) {
+					left = append(left, file)
 				}
+				results.add(res, reportGetError(err))
 			}
-			for _, file := range args {
-				if err := getSubs(client, file, l); err != nil {
-					if err != NoSub {
-						fmt.Printf("Error: %s\n", err)
-						return
-					}
-					fmt.Println(err)
-					continue
-				} else {
-					return
+		} else {
+			for _, j := range runGetJobs(client, files, states) {
+				if quotaExceeded(j.err) && (len(left) == 0 || left[len(left)-1] != j.file) {
+					left = append(left, j.file)
 				}
+				results.add(j.res, reportGetError(j.err))
 			}
 		}
+		reportQuotaStop(left)
+		results.print()
+		saveHashCache()
+		getJournal.close()
+		os.Exit(results.exitCode())
 	},
 }
 
-func getSubs(client *osdb.Client, file string, lang string) error {
-	fmt.Printf("- Getting %s subtitles for file: %s\n", lang, path.Base(file))
-	subs, err := client.FileSearch(file, []string{lang})
+// Print a file's error, and pass it on. Download quota errors are only
+// reported once, see reportQuotaStop.
+func reportGetError(err error) error {
+	switch err := err.(type) {
+	case *osdb.DownloadLimitError:
+		return err
+	case *skipError:
+		logf("- Skipped: %s\n", err)
+		return err
+	}
+	if err == NoSub {
+		logf("%s\n", err)
+	} else if err != nil {
+		logf("Error: %s\n", err)
+	}
+	return err
+}
+
+// List the video files to process from command-line arguments: files,
+// directories, or URLs of remote videos.
+func expandPaths(args []string) ([]string, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("missing file or directory")
+	}
+	files := []string{}
+	for _, arg := range args {
+		if isURL(arg) {
+			files = append(files, arg)
+			continue
+		}
+		fi, err := os.Stat(arg)
+		if err != nil {
+			return nil, err
+		}
+		if fi.IsDir() {
+			files = append(files, getFilesFromPath(arg)...)
+		} else {
+			files = append(files, arg)
+		}
+	}
+	return files, nil
+}
+
+// Key of doneParts entries.
+func partKey(file string, lang string) string {
+	return lang + ":" + file
+}
+
+// Download all the parts of a multi-CD subtitle. When file is part of a
+// multi-part video, each subtitle part is saved next to its video part,
+// otherwise the parts are joined in a single subtitle.
+func getMultiCDSubs(client *osdb.Client, file string, lang string, best *osdb.Subtitle, subs osdb.Subtitles, res *fileResult) error {
+	parts := subs.Parts(best)
+	if parts == nil && best.IDMovieImdb != "" {
+		// Hash searches only return the matching part.
+		more, err := client.IMDBSearchByID([]string{best.IDMovieImdb}, []string{lang})
+		if err != nil {
+			return err
+		}
+		parts = more.Parts(best)
+	}
+	if parts == nil {
+		return fmt.Errorf("Missing parts of %d-CD subtitle %s", best.CDCount(), best.IDSubtitle)
+	}
+
+	videos := videoParts(file)
+	if len(videos) != len(parts) {
+		videos = nil
+	}
+	// Joined parts are shifted by the lengths of the video parts before
+	// them, as known to OSDB.
+	var durations []time.Duration
+	if videos == nil {
+		for i := range parts[:len(parts)-1] {
+			d := parts[i].MovieDuration()
+			if d == 0 {
+				return fmt.Errorf("Can't join %d-CD subtitle %s: unknown length of video part %d, see osdb join --durations",
+					len(parts), best.IDSubtitle, i+1)
+			}
+			durations = append(durations, d)
+		}
+	}
+	dests := make([]string, len(parts))
+	for i := range parts {
+		if videos != nil {
+			dests[i] = subtitlePath(videos[i], &parts[i], outputFormat())
+		} else {
+			dests[i] = subtitlePath(file, best, "srt")
+		}
+		if err := checkDest(dests[i]); err != nil {
+			return err
+		}
+	}
+	if paramDryRun {
+		for i := range parts {
+			logf("- Would download CD%d %s to: %s\n", i+1, parts[i].IDSubtitleFile, dests[i])
+			res.saved(parts[i].IDSubtitleFile, dests[i])
+			if videos != nil {
+				doneParts[partKey(videos[i], lang)] = true
+			}
+		}
+		return nil
+	}
+
+	files, err := client.DownloadSubtitles(parts)
+	if err != nil {
+		return err
+	}
+	if len(files) != len(parts) {
+		return fmt.Errorf("Expected %d subtitle files, got %d", len(parts), len(files))
+	}
+
+	if videos != nil {
+		for i, video := range videos {
+			dest := dests[i]
+			logf("- Downloading CD%d to: %s\n", i+1, dest)
+			if err := saveSubtitleFile(&files[i], dest); err != nil {
+				return err
+			}
+			res.saved(parts[i].IDSubtitleFile, dest)
+			doneParts[partKey(video, lang)] = true
+		}
+		return nil
+	}
+
+	// A single video file: join the parts.
+	docs := make([]*osdb.Document, len(files))
+	for i := range files {
+		if docs[i], err = files[i].Parse(); err != nil {
+			return err
+		}
+	}
+	joined, err := osdb.Join(docs, durations)
+	if err != nil {
+		return err
+	}
+	if paramStripHI {
+		joined = joined.StripHearingImpaired()
+	}
+	dest := dests[0]
+	logf("- Joining %d CDs to: %s\n", len(parts), dest)
+	if err := saveSubtitleData(joined.Bytes(), dest); err != nil {
+		return err
+	}
+	for i := range parts {
+		res.saved(parts[i].IDSubtitleFile, dest)
+	}
+	return nil
+}
+
+// Download subtitles in two languages for a file, and merge them into
+// a single bilingual subtitle.
+func getMergedSubs(client *osdb.Client, file string, top string, bottom string, res *fileResult) error {
+	logf("- Getting %s+%s subtitles for file: %s\n", top, bottom, path.Base(file))
+	mergedSub := &osdb.Subtitle{
+		SubLanguageID: strings.ToLower(top + "-" + bottom),
+		ISO639:        shortLanguage(top) + "-" + shortLanguage(bottom),
+	}
+	dest := subtitlePath(file, mergedSub, paramMergeFmt)
+	if err := checkDest(dest); err != nil {
+		return err
+	}
+	hash, size, err := fileHash(file)
+	if err != nil {
+		return err
+	}
+	subs := osdb.Subtitles{}
+	for _, lang := range []string{top, bottom} {
+		res, err := client.HashSearch(hash, size, []string{lang})
+		if err != nil {
+			return err
+		}
+		best := res.Best()
+		if best == nil {
+			return fmt.Errorf("No %s subtitles found!", lang)
+		}
+		subs = append(subs, *best)
+	}
+	if paramDryRun {
+		logf("- Would merge %s and %s to: %s\n", subs[0].IDSubtitleFile, subs[1].IDSubtitleFile, dest)
+		for i := range subs {
+			res.saved(subs[i].IDSubtitleFile, dest)
+		}
+		return nil
+	}
+
+	files, err := client.DownloadSubtitles(subs)
+	if err != nil {
+		return err
+	}
+	if len(files) != 2 {
+		return fmt.Errorf("No file match these subtitle IDs")
+	}
+	docs := make([]*osdb.Document, 2)
+	for i := range files {
+		if docs[i], err = files[i].Parse(); err != nil {
+			return err
+		}
+		if paramStripHI {
+			docs[i] = docs[i].StripHearingImpaired()
+		}
+	}
+
+	merged := osdb.Merge(docs[0], docs[1])
+	buf := new(bytes.Buffer)
+	if paramMergeFmt == "ass" {
+		err = merged.WriteASS(buf)
+	} else {
+		err = merged.WriteSRT(buf)
+	}
+	if err != nil {
+		return err
+	}
+	logf("- Downloading to: %s\n", dest)
+	if err := saveSubtitleData(buf.Bytes(), dest); err != nil {
+		return err
+	}
+	for i := range subs {
+		res.saved(subs[i].IDSubtitleFile, dest)
+	}
+	return nil
+}
+
+// Write a downloaded subtitle file to dest, applying the command-line
+// cleaning and encoding options.
+func saveSubtitleFile(sf *osdb.SubtitleFile, dest string) error {
+	data, err := sf.Bytes()
 	if err != nil {
 		return err
 	}
+	if paramStripHI {
+		doc, err := osdb.ParseBytes(data)
+		if err != nil {
+			return err
+		}
+		data = doc.StripHearingImpaired().Bytes()
+	}
+	return saveSubtitleData(data, dest)
+}
 
-	if best := subs.Best(); best != nil {
-		dest := file[0:len(file)-len(path.Ext(file))] + ".srt"
-		fmt.Printf("- Downloading to: %s\n", dest)
-		// XXX check if dest exists instead of overwriting?
-		return client.DownloadTo(best, dest)
+// Write UTF-8 subtitle data to dest, with the command-line encoding
+// options.
+func saveSubtitleData(data []byte, dest string) error {
+	buf := new(bytes.Buffer)
+	if err := saveOpts.Save(buf, bytes.NewReader(data)); err != nil {
+		uerr, ok := err.(*osdb.UnmappableError)
+		if !ok || !saveOpts.Substitute {
+			return err
+		}
+		logf("- Warning: %s\n", uerr)
+	}
+	if err := os.MkdirAll(path.Dir(dest), 0755); err != nil {
+		return err
+	}
+	if err := backupDest(dest); err != nil {
+		return err
 	}
-	return NoSub
+	return ioutil.WriteFile(dest, buf.Bytes(), 0644)
 }
 
-func getFilesFromPath(dir string) []string {
-	files := []string{}
-	entries, _ := ioutil.ReadDir(dir)
-	for _, e := range entries {
-		file := path.Join(dir, e.Name())
-		buf, _ := ioutil.ReadFile(file)
-		if filetype.IsVideo(buf) {
-			files = append(files, file)
+// Format of saved subtitles: their own, unless they are re-written.
+func outputFormat() string {
+	if paramStripHI {
+		return "srt"
+	}
+	return ""
+}
+
+// Build osdb.SaveOptions from the command-line flags.
+func parseSaveOptions() (opts osdb.SaveOptions, err error) {
+	if paramEncoding != "" {
+		if opts.Encoding, err = osdb.EncodingByName(paramEncoding); err != nil {
+			return
 		}
 	}
-	return files
+
+	switch strings.ToLower(paramBOM) {
+	case "keep":
+		opts.BOM = osdb.BOMKeep
+	case "strip":
+		opts.BOM = osdb.BOMStrip
+	case "add":
+		opts.BOM = osdb.BOMAdd
+	default:
+		return opts, fmt.Errorf("invalid --bom value %q", paramBOM)
+	}
+
+	switch strings.ToLower(paramEOL) {
+	case "keep":
+		opts.EOL = osdb.LineEndingKeep
+	case "lf":
+		opts.EOL = osdb.LineEndingLF
+	case "crlf":
+		opts.EOL = osdb.LineEndingCRLF
+	default:
+		return opts, fmt.Errorf("invalid --eol value %q", paramEOL)
+	}
+
+	opts.Substitute = paramSubstitute
+	return
 }
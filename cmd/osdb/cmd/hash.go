@@ -1,11 +1,11 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path"
 
-	"github.com/oz/osdb"
 	"github.com/spf13/cobra"
 )
 
@@ -13,25 +13,60 @@ func init() {
 	RootCmd.AddCommand(hashCmd)
 }
 
+// A file's hash, as printed by hash.
+type hashRecord struct {
+	File string `json:"file"`
+	Hash string `json:"hash"`
+	Size int64  `json:"size"`
+}
+
 var hashCmd = &cobra.Command{
-	Use:   "hash [file]",
+	Use:   "hash [file|url]",
 	Short: "Shows OSDB hash for file.",
-	Long:  `Read file and compute its OSDB hash.`,
+	Long: `Read file and compute its OSDB hash. Remote files, given by an
+http(s) URL, are read with HTTP Range requests. For RAR and ZIP
+archives, the hash is the one of the video they store, uncompressed:
+give the first volume of multi-volume RAR archives. Split ZIP archives
+are not supported.`,
 	PreRun: func(cmd *cobra.Command, args []string) {
 		if len(args) != 1 {
-			fmt.Println("Invalid parameters.")
-			os.Exit(1)
+			fail(errors.New("invalid parameters"))
 		}
 	},
 	Run: func(cmd *cobra.Command, args []string) {
+		out := newPrinter("FILE", "HASH", "SIZE")
+		failed := false
 		for _, file := range args {
-			h, err := osdb.Hash(file)
+			r, err := hashFile(file)
 			if err != nil {
-				fmt.Printf("Error: %s", err)
-			} else {
-				basePath := path.Base(file)
-				fmt.Printf("%s: %x\n", basePath, h)
+				failed = true
+				if !machineOutput() {
+					fmt.Printf("Error: %s\n", err)
+					continue
+				}
+				out.add(errorRecord{Error: err.Error(), File: file}, file, "", "")
+				continue
 			}
+			if !machineOutput() {
+				fmt.Printf("%s: %s\n", path.Base(file), r.Hash)
+				continue
+			}
+			out.add(r, r.File, r.Hash, fmt.Sprintf("%d", r.Size))
+		}
+		if machineOutput() {
+			out.flush()
+		}
+		saveHashCache()
+		if failed {
+			os.Exit(ExitFailure)
 		}
 	},
 }
+
+func hashFile(file string) (r hashRecord, err error) {
+	h, size, err := fileHash(file)
+	if err != nil {
+		return
+	}
+	return hashRecord{File: file, Hash: fmt.Sprintf("%x", h), Size: size}, nil
+}
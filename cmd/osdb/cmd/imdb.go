@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"strings"
@@ -17,31 +18,68 @@ func init() {
 	RootCmd.AddCommand(imdbCmd)
 }
 
+// A movie, as printed by imdb.
+type movieRecord struct {
+	ID    string `json:"id"`
+	Title string `json:"title"`
+	Year  string `json:"year,omitempty"`
+	URL   string `json:"url"`
+}
+
+// A movie's details, as printed by imdb show.
+type movieDetailsRecord struct {
+	ID             string            `json:"id"`
+	Title          string            `json:"title"`
+	Year           string            `json:"year"`
+	Duration       string            `json:"duration"`
+	Cover          string            `json:"cover"`
+	TagLine        string            `json:"tagline"`
+	Plot           string            `json:"plot"`
+	Goofs          string            `json:"goofs"`
+	Trivia         string            `json:"trivia"`
+	Cast           map[string]string `json:"cast"`
+	Directors      map[string]string `json:"directors"`
+	Writers        map[string]string `json:"writers"`
+	Awards         []string          `json:"awards"`
+	Genres         []string          `json:"genres"`
+	Countries      []string          `json:"countries"`
+	Languages      []string          `json:"languages"`
+	Certifications []string          `json:"certifications"`
+	URL            string            `json:"url"`
+}
+
+func imdbURL(id string) string {
+	return fmt.Sprintf("http://www.imdb.com/title/tt%s/", id)
+}
+
 var imdbCmd = &cobra.Command{
 	Use:   "imdb [query]",
 	Short: "Search IMDB",
 	Long:  `Search IMDB for a movie, through OSDB's API.`,
 	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		RootCmd.PersistentPreRun(cmd, args)
 		c, err := InitClient(os.Getenv("OSDB_LANG"))
 		if err != nil {
-			fmt.Printf("Error: %s\n", err)
-			return
+			fail(err)
 		}
 		client = c
 	},
 	Run: func(cmd *cobra.Command, args []string) {
 		q := strings.Join(args, " ")
-		fmt.Printf("Searching %s on IMDB...\n\n", q)
+		logf("Searching %s on IMDB...\n\n", q)
 		movies, err := client.IMDBSearch(q)
 		if err != nil {
-			fmt.Printf("Error: %s\n", err)
-			return
+			fail(err)
 		}
 		if movies.Empty() {
-			fmt.Println("No results.")
+			logf("No results.\n")
 		}
+		out := newPrinter("ID", "TITLE", "URL")
 		for _, m := range movies {
-			fmt.Printf("%s %s http://www.imdb.com/title/tt%s/\n", m.ID, m.Title, m.ID)
+			out.add(movieRecord{m.ID, m.Title, m.Year, imdbURL(m.ID)}, m.ID, m.Title, imdbURL(m.ID))
+		}
+		if machineOutput() || !movies.Empty() {
+			out.flush()
 		}
 	},
 }
@@ -52,22 +90,56 @@ var imdbShowCmd = &cobra.Command{
 	Long:  `Display movie facts for an IMDB movie.`,
 	PreRun: func(cmd *cobra.Command, args []string) {
 		if len(args) < 1 {
-			fmt.Println("Missing movie ID")
-			os.Exit(1)
+			fail(errors.New("missing movie ID"))
 		}
 	},
 	Run: func(cmd *cobra.Command, args []string) {
+		out := newPrinter("ID", "TITLE", "YEAR", "DURATION", "URL")
 		for _, id := range args {
 			m, err := client.GetIMDBMovieDetails(id)
 			if err != nil {
-				fmt.Printf("Error: %s\n", err)
-				return
+				if !machineOutput() {
+					fmt.Printf("Error: %s\n", err)
+					return
+				}
+				out.add(errorRecord{Error: err.Error(), ID: id}, id, "", "", "", "")
+				continue
+			}
+			if !machineOutput() {
+				showMovieDetails(m)
+				continue
 			}
-			showMovieDetails(m)
+			out.add(newMovieDetailsRecord(m), m.ID, m.Title, m.Year, m.Duration, imdbURL(m.ID))
+		}
+		if machineOutput() {
+			out.flush()
 		}
 	},
 }
 
+func newMovieDetailsRecord(m *osdb.Movie) movieDetailsRecord {
+	return movieDetailsRecord{
+		ID:             m.ID,
+		Title:          m.Title,
+		Year:           m.Year,
+		Duration:       m.Duration,
+		Cover:          m.Cover,
+		TagLine:        m.TagLine,
+		Plot:           m.Plot,
+		Goofs:          m.Goofs,
+		Trivia:         m.Trivia,
+		Cast:           m.Cast,
+		Directors:      m.Directors,
+		Writers:        m.Writers,
+		Awards:         m.Awards,
+		Genres:         m.Genres,
+		Countries:      m.Countries,
+		Languages:      m.Languages,
+		Certifications: m.Certifications,
+		URL:            imdbURL(m.ID),
+	}
+}
+
 func showMovieDetails(m *osdb.Movie) {
 	w := new(tabwriter.Writer)
 	w.Init(os.Stdout, 0, 8, 0, '\t', 0)
@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/oz/osdb"
+	"github.com/spf13/cobra"
+)
+
+var (
+	paramJoinDurations string
+	paramJoinVideos    []string
+	paramJoinOutput    string
+)
+
+func init() {
+	joinCmd.Flags().StringVar(&paramJoinDurations, "durations", "", "Comma-separated durations of the parts, e.g. 52m10s")
+	joinCmd.Flags().StringSliceVar(&paramJoinVideos, "videos", nil, "Video parts, to use their durations (needs ffprobe)")
+	joinCmd.Flags().StringVar(&paramJoinOutput, "out", "", "Joined subtitle file")
+	RootCmd.AddCommand(joinCmd)
+}
+
+var joinCmd = &cobra.Command{
+	Use:   "join [sub_files...]",
+	Short: "Join subtitle parts",
+	Long: `Concatenate the parts of a multi-CD subtitle into a single file. Each
+part is shifted by the durations of the parts before it, given with
+--durations, or read from the video parts with --videos.`,
+	PreRun: func(cmd *cobra.Command, args []string) {
+		if len(args) < 2 || paramJoinOutput == "" ||
+			(paramJoinDurations == "") == (len(paramJoinVideos) == 0) {
+			fmt.Println("Invalid parameters: need subtitle parts, --out, and either --durations or --videos.")
+			os.Exit(1)
+		}
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := joinSubs(args, paramJoinOutput); err != nil {
+			fmt.Printf("Error: %s\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+func joinSubs(files []string, dest string) (err error) {
+	parts := make([]*osdb.Document, len(files))
+	for i, file := range files {
+		if parts[i], err = readDocument(file); err != nil {
+			return
+		}
+	}
+
+	var durations []time.Duration
+	if paramJoinDurations != "" {
+		durations, err = parseTimes(paramJoinDurations)
+	} else {
+		durations, err = videoDurations(paramJoinVideos)
+	}
+	if err != nil {
+		return
+	}
+
+	doc, err := osdb.Join(parts, durations)
+	if err != nil {
+		return
+	}
+	fmt.Printf("- Joined %d parts, %d cues to %s\n", len(parts), len(doc.Cues), dest)
+	return ioutil.WriteFile(dest, doc.Bytes(), 0644)
+}
@@ -0,0 +1,273 @@
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/oz/osdb"
+)
+
+// Job states, as recorded in the journal.
+const (
+	JobHashed     = "hashed"
+	JobSearched   = "searched"
+	JobPicked     = "picked"
+	JobDownloaded = "downloaded"
+	JobSkipped    = "skipped"
+	JobMissing    = "missing"
+	JobFailed     = "failed"
+)
+
+var (
+	paramJournal = defaultJournal()
+	paramResume  bool
+
+	// The journal of the current run, nil when disabled.
+	getJournal *journal
+)
+
+// The files and languages of a run, first in the journal.
+type journalRun struct {
+	Files []string `json:"files"`
+	Langs []string `json:"langs"`
+}
+
+// A journal line: the run, or the new state of a job.
+type journalRecord struct {
+	Time       time.Time   `json:"time"`
+	Run        *journalRun `json:"run,omitempty"`
+	File       string      `json:"file,omitempty"`
+	Lang       string      `json:"lang,omitempty"`
+	State      string      `json:"state,omitempty"`
+	Hash       string      `json:"hash,omitempty"`
+	Size       int64       `json:"size,omitempty"`
+	Candidates int         `json:"candidates,omitempty"`
+	SubtitleID string      `json:"subtitle_id,omitempty"`
+	Encoding   string      `json:"encoding,omitempty"`
+	Dest       string      `json:"dest,omitempty"`
+	Paths      []string    `json:"paths,omitempty"`
+	Error      string      `json:"error,omitempty"`
+}
+
+// A journal of get jobs, in NDJSON: one line per state change, appended
+// as jobs progress, so that a run can be interrupted at any point.
+type journal struct {
+	mu  sync.Mutex
+	fh  *os.File
+	enc *json.Encoder
+}
+
+// Directory for osdb's own files, such as the journal and caches.
+func cacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "osdb")
+}
+
+func defaultJournal() string {
+	if dir := cacheDir(); dir != "" {
+		return filepath.Join(dir, "get.journal")
+	}
+	return ""
+}
+
+// Open a journal, to continue it, or to start a new run.
+func openJournal(path string, run *journalRun) (*journal, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	flags := os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	if run != nil {
+		flags |= os.O_TRUNC
+	}
+	fh, err := os.OpenFile(path, flags, 0644)
+	if err != nil {
+		return nil, err
+	}
+	jl := &journal{fh: fh, enc: json.NewEncoder(fh)}
+	if run != nil {
+		jl.write(journalRecord{Run: run})
+	}
+	return jl, nil
+}
+
+func (jl *journal) write(r journalRecord) {
+	if jl == nil {
+		return
+	}
+	r.Time = time.Now()
+	jl.mu.Lock()
+	defer jl.mu.Unlock()
+	if err := jl.enc.Encode(r); err != nil {
+		logf("Warning: can't write the journal: %s\n", err)
+	}
+}
+
+// Record a job's new state.
+func (jl *journal) record(j *getJob, state string) {
+	if jl == nil {
+		return
+	}
+	r := journalRecord{File: j.file, Lang: j.lang, State: state}
+	switch state {
+	case JobHashed:
+		r.Hash, r.Size = fmt.Sprintf("%016x", j.hash), j.size
+	case JobSearched:
+		r.Candidates = len(j.subs)
+	case JobPicked:
+		r.SubtitleID, r.Encoding, r.Dest = j.best.IDSubtitleFile, j.best.SubEncoding, j.dest
+	case JobDownloaded:
+		r.Paths = j.res.Paths
+	}
+	if j.err != nil {
+		r.Error = j.err.Error()
+	}
+	jl.write(r)
+}
+
+// Record the final state of a job, from its error.
+func (jl *journal) finish(j *getJob) {
+	switch j.err.(type) {
+	case nil:
+		jl.record(j, JobDownloaded)
+	case *skipError:
+		jl.record(j, JobSkipped)
+	default:
+		if j.err == NoSub {
+			jl.record(j, JobMissing)
+		} else {
+			jl.record(j, JobFailed)
+		}
+	}
+}
+
+func (jl *journal) close() {
+	if jl != nil {
+		jl.fh.Close()
+	}
+}
+
+// Read a journal: its run, and the latest known state of each job, by
+// partKey. A truncated last line, from an interrupted run, is ignored.
+func loadJournal(path string) (*journalRun, map[string]journalRecord, error) {
+	fh, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer fh.Close()
+
+	var run *journalRun
+	states := map[string]journalRecord{}
+	scanner := bufio.NewScanner(fh)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var r journalRecord
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			continue
+		}
+		if r.Run != nil {
+			run = r.Run
+			continue
+		}
+		key := partKey(r.File, r.Lang)
+		s := states[key]
+		s.File, s.Lang, s.State, s.Error = r.File, r.Lang, r.State, r.Error
+		if r.Hash != "" {
+			s.Hash, s.Size = r.Hash, r.Size
+		}
+		switch r.State {
+		case JobHashed, JobSearched:
+			s.SubtitleID, s.Encoding, s.Dest = "", "", ""
+		case JobPicked:
+			s.SubtitleID, s.Encoding, s.Dest = r.SubtitleID, r.Encoding, r.Dest
+		}
+		s.Paths = r.Paths
+		states[key] = s
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+	if run == nil {
+		return nil, nil, fmt.Errorf("%s: not a journal of osdb get", path)
+	}
+	return run, states, nil
+}
+
+// List the files of a run with unfinished jobs, interrupted before
+// they were downloaded, skipped, missing or failed. Failed jobs are
+// finished: they may fail again for good, e.g. for small files, and
+// --resume only retries them.
+func unfinishedJobs(run *journalRun, states map[string]journalRecord) []string {
+	files := []string{}
+	for _, file := range run.Files {
+		for _, lang := range run.Langs {
+			switch states[partKey(file, lang)].State {
+			case JobDownloaded, JobSkipped, JobMissing, JobFailed:
+				continue
+			}
+			files = append(files, file)
+			break
+		}
+	}
+	return files
+}
+
+// Check that a new run of files may start a journal at path: it must
+// not replace the unfinished jobs of the same files, which could still
+// be resumed. Unfinished jobs of other files are only warned about.
+func checkJournal(path string, files []string) error {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil
+	}
+	run, states, err := loadJournal(path)
+	if err != nil {
+		return nil // nothing to resume
+	}
+	unfinished := unfinishedJobs(run, states)
+	if len(unfinished) == 0 {
+		return nil
+	}
+	wanted := map[string]bool{}
+	for _, file := range files {
+		wanted[file] = true
+	}
+	for _, file := range unfinished {
+		if wanted[file] {
+			return fmt.Errorf("journal %s has unfinished jobs for %s: continue them with --resume, or use --force to start a new run, or another --journal", path, file)
+		}
+	}
+	logf("Warning: replacing journal %s, with unfinished jobs for %d other files\n", path, len(unfinished))
+	return nil
+}
+
+// Restore a job from its state in a previous run: finished jobs are
+// skipped, and others start again after their last completed stage.
+// Jobs that failed after picking a subtitle only retry downloading it.
+func (j *getJob) resume(s journalRecord) {
+	switch s.State {
+	case JobDownloaded:
+		j.res.Paths = s.Paths
+		j.err = &skipError{"downloaded by a previous run"}
+		return
+	case JobSkipped, JobMissing:
+		j.err = &skipError{s.State + " in a previous run"}
+		return
+	case JobPicked, JobFailed:
+		if s.SubtitleID != "" {
+			j.best = &osdb.Subtitle{IDSubtitleFile: s.SubtitleID, SubEncoding: s.Encoding}
+			j.dest = s.Dest
+		}
+	}
+	if s.Hash != "" {
+		j.hash, _ = strconv.ParseUint(s.Hash, 16, 64)
+		j.size = s.Size
+	}
+}
@@ -0,0 +1,167 @@
+package cmd
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/oz/osdb"
+)
+
+func tempDir(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "osdb")
+	if err != nil {
+		t.Fatalf("Can't create temp dir: %s", err)
+	}
+	return dir, func() { os.RemoveAll(dir) }
+}
+
+// Write a journal: a.avi was downloaded, b.avi picked a subtitle before
+// an interruption, c.avi was only hashed, d.avi failed, e.avi has no
+// subtitles.
+func writeTestJournal(t *testing.T, path string) {
+	jl, err := openJournal(path, &journalRun{
+		Files: []string{"a.avi", "b.avi", "c.avi", "d.avi", "e.avi"},
+		Langs: []string{"eng"},
+	})
+	if err != nil {
+		t.Fatalf("Can't open journal: %s", err)
+	}
+	jobs := map[string]*getJob{}
+	for _, f := range []string{"a.avi", "b.avi", "c.avi", "d.avi", "e.avi"} {
+		jobs[f] = &getJob{file: f, lang: "eng", hash: 0x42, size: 1000}
+		jl.record(jobs[f], JobHashed)
+	}
+	for _, f := range []string{"a.avi", "b.avi"} {
+		jobs[f].best = &osdb.Subtitle{IDSubtitleFile: "7", SubEncoding: "CP1252"}
+		jobs[f].dest = f + ".en.srt"
+		jl.record(jobs[f], JobPicked)
+	}
+	jobs["a.avi"].res.Paths = []string{"a.en.srt"}
+	jl.finish(jobs["a.avi"])
+	jobs["d.avi"].err = errors.New("boom")
+	jl.finish(jobs["d.avi"])
+	jobs["e.avi"].err = NoSub
+	jl.finish(jobs["e.avi"])
+	jl.close()
+}
+
+func TestJournalReplay(t *testing.T) {
+	dir, done := tempDir(t)
+	defer done()
+	path := filepath.Join(dir, "get.journal")
+	writeTestJournal(t, path)
+
+	// A truncated last line, from an interruption, is ignored.
+	fh, _ := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	fh.WriteString(`{"file":"c.avi","lang":"eng","sta`)
+	fh.Close()
+
+	run, states, err := loadJournal(path)
+	if err != nil {
+		t.Fatalf("Can't load journal: %s", err)
+	}
+	if len(run.Files) != 5 || len(run.Langs) != 1 {
+		t.Fatalf("Unexpected run: %+v", run)
+	}
+	for file, state := range map[string]string{
+		"a.avi": JobDownloaded,
+		"b.avi": JobPicked,
+		"c.avi": JobHashed,
+		"d.avi": JobFailed,
+		"e.avi": JobMissing,
+	} {
+		if s := states[partKey(file, "eng")]; s.State != state {
+			t.Errorf("%s: expected state %s, got %s", file, state, s.State)
+		}
+	}
+	if files := unfinishedJobs(run, states); !reflect.DeepEqual(files, []string{"b.avi", "c.avi"}) {
+		t.Errorf("Expected unfinished jobs for b.avi and c.avi, got %v", files)
+	}
+
+	for _, tt := range []struct {
+		file    string
+		skipped bool
+		best    bool
+		hash    uint64
+	}{
+		{"a.avi", true, false, 0},
+		{"b.avi", false, true, 0x42},
+		{"c.avi", false, false, 0x42},
+		{"d.avi", false, false, 0x42},
+		{"e.avi", true, false, 0},
+	} {
+		j := &getJob{file: tt.file, lang: "eng"}
+		j.resume(states[partKey(tt.file, "eng")])
+		_, skipped := j.err.(*skipError)
+		if skipped != tt.skipped || (j.best != nil) != tt.best || j.hash != tt.hash {
+			t.Errorf("%s: unexpected resumed job: err %v, best %v, hash %x", tt.file, j.err, j.best, j.hash)
+		}
+	}
+	j := &getJob{file: "b.avi", lang: "eng"}
+	j.resume(states[partKey("b.avi", "eng")])
+	if j.best.IDSubtitleFile != "7" || j.best.SubEncoding != "CP1252" || j.dest != "b.avi.en.srt" {
+		t.Errorf("Unexpected resumed pick: %+v, %s", j.best, j.dest)
+	}
+}
+
+func TestCheckJournal(t *testing.T) {
+	dir, done := tempDir(t)
+	defer done()
+	path := filepath.Join(dir, "get.journal")
+
+	if err := checkJournal(path, []string{"a.avi"}); err != nil {
+		t.Fatalf("Expected no error without a journal, got %s", err)
+	}
+	writeTestJournal(t, path)
+	for _, tt := range []struct {
+		files []string
+		ok    bool
+	}{
+		{[]string{"b.avi"}, false},          // interrupted
+		{[]string{"x.avi", "c.avi"}, false}, // interrupted
+		{[]string{"a.avi", "e.avi"}, true},  // done
+		{[]string{"d.avi"}, true},           // failed
+		{[]string{"x.avi"}, true},           // other files
+	} {
+		if err := checkJournal(path, tt.files); (err == nil) != tt.ok {
+			t.Errorf("%v: expected ok %v, got error %v", tt.files, tt.ok, err)
+		}
+	}
+
+	// Continuing the journal, until all jobs are done.
+	jl, err := openJournal(path, nil)
+	if err != nil {
+		t.Fatalf("Can't open journal: %s", err)
+	}
+	for _, f := range []string{"b.avi", "c.avi", "d.avi"} {
+		jl.finish(&getJob{file: f, lang: "eng", err: &skipError{"test"}})
+	}
+	jl.close()
+	if err := checkJournal(path, []string{"b.avi"}); err != nil {
+		t.Fatalf("Expected no error for a finished journal, got %s", err)
+	}
+}
+
+func TestCheckJournalAfterFailure(t *testing.T) {
+	dir, done := tempDir(t)
+	defer done()
+	path := filepath.Join(dir, "get.journal")
+
+	// A file too small to hash fails for good.
+	jl, err := openJournal(path, &journalRun{Files: []string{"small.avi"}, Langs: []string{"eng"}})
+	if err != nil {
+		t.Fatalf("Can't open journal: %s", err)
+	}
+	jl.finish(&getJob{file: "small.avi", lang: "eng", err: errors.New("File is too small")})
+	jl.close()
+
+	for _, files := range [][]string{{"other.avi"}, {"small.avi"}} {
+		if err := checkJournal(path, files); err != nil {
+			t.Errorf("%v: expected a new run to proceed, got %s", files, err)
+		}
+	}
+}
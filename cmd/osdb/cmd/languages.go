@@ -0,0 +1,42 @@
+package cmd
+
+import "strings"
+
+// ISO 639-2 codes, as used by OSDB, to ISO 639-1 codes.
+var iso639Codes = map[string]string{
+	"alb": "sq", "ara": "ar", "arm": "hy", "baq": "eu", "ben": "bn",
+	"bos": "bs", "bre": "br", "bul": "bg", "bur": "my", "cat": "ca",
+	"chi": "zh", "cze": "cs", "dan": "da", "dut": "nl", "eng": "en",
+	"epo": "eo", "est": "et", "fin": "fi", "fre": "fr", "geo": "ka",
+	"ger": "de", "glg": "gl", "gre": "el", "heb": "he", "hin": "hi",
+	"hrv": "hr", "hun": "hu", "ice": "is", "ind": "id", "ita": "it",
+	"jpn": "ja", "kaz": "kk", "khm": "km", "kor": "ko", "lav": "lv",
+	"lit": "lt", "ltz": "lb", "mac": "mk", "may": "ms", "mal": "ml",
+	"mon": "mn", "nor": "no", "oci": "oc", "per": "fa", "pol": "pl",
+	"por": "pt", "rum": "ro", "rus": "ru", "scc": "sr", "sin": "si",
+	"slo": "sk", "slv": "sl", "spa": "es", "swa": "sw", "swe": "sv",
+	"tam": "ta", "tel": "te", "tgl": "tl", "tha": "th", "tur": "tr",
+	"ukr": "uk", "urd": "ur", "vie": "vi", "wel": "cy",
+	// Terminology codes, and OSDB specials.
+	"sqi": "sq", "hye": "hy", "eus": "eu", "mya": "my", "zho": "zh",
+	"ces": "cs", "nld": "nl", "fra": "fr", "kat": "ka", "deu": "de",
+	"ell": "el", "isl": "is", "mkd": "mk", "msa": "ms", "fas": "fa",
+	"ron": "ro", "srp": "sr", "slk": "sk", "cym": "cy",
+	"pob": "pb", "zht": "zt", "zhe": "ze",
+}
+
+// Codes a language may be tagged with in file names, e.g. "en", "eng".
+func languageTags(lang string) []string {
+	lang = strings.ToLower(lang)
+	tags := []string{lang}
+	if code, ok := iso639Codes[lang]; ok {
+		tags = append(tags, code)
+	}
+	return tags
+}
+
+// Short code of a language, e.g. "en" for "eng", when known.
+func shortLanguage(lang string) string {
+	tags := languageTags(lang)
+	return tags[len(tags)-1]
+}
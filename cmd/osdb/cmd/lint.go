@@ -0,0 +1,158 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+
+	"github.com/oz/osdb"
+	"github.com/spf13/cobra"
+)
+
+var (
+	paramLintJSON bool
+	paramLintFix  bool
+	lintOpts      osdb.LintOptions
+)
+
+func init() {
+	lintCmd.Flags().BoolVar(&paramLintJSON, "json", false, "Print diagnostics as JSON, like --output json")
+	lintCmd.Flags().BoolVar(&paramLintFix, "fix", false, "Fix mechanical issues, rewriting files in place")
+	lintCmd.Flags().DurationVar(&lintOpts.MovieDuration, "movie-duration", 0, "Movie length, e.g. 1h42m10s")
+	lintCmd.Flags().IntVar(&lintOpts.MaxLineLength, "max-line-length", osdb.DefaultMaxLineLength, "Maximum characters per line")
+	lintCmd.Flags().Float64Var(&lintOpts.MaxCPS, "max-cps", osdb.DefaultMaxCPS, "Maximum reading speed, in characters per second")
+	RootCmd.AddCommand(lintCmd)
+}
+
+// Lint results for a file, as printed by JSON outputs.
+type lintReport struct {
+	File        string            `json:"file"`
+	Error       string            `json:"error,omitempty"`
+	Diagnostics []osdb.Diagnostic `json:"diagnostics"`
+	Fixed       []osdb.Diagnostic `json:"fixed,omitempty"`
+}
+
+var lintCmd = &cobra.Command{
+	Use:   "lint [sub_files...]",
+	Short: "Check subtitles for common problems",
+	Long: `Check subtitle files for overlapping cues, bad timings, long lines,
+fast reading speeds, unbalanced tags, and encoding artifacts.
+
+With --output json or ndjson, a record is printed per file, and with
+tsv, a row per diagnostic.
+
+Exits with status 1 when errors are found.`,
+	PreRun: func(cmd *cobra.Command, args []string) {
+		if paramLintJSON {
+			paramOutputFormat = OutputJSON
+		}
+		if len(args) < 1 {
+			fail(errors.New("missing subtitle files"))
+		}
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		failed := false
+		reports := newPrinter()
+		rows := newPrinter("FILE", "CUE", "LINE", "SEVERITY", "CODE", "MESSAGE", "FIXED")
+		for _, file := range args {
+			r := lintSubs(file)
+			if r.Error != "" {
+				failed = true
+			}
+			for _, d := range r.Diagnostics {
+				if d.Severity == osdb.SeverityError {
+					failed = true
+				}
+			}
+			switch paramOutputFormat {
+			case OutputTable:
+				printLintReport(r)
+			case OutputTSV:
+				addLintRows(rows, r)
+			default:
+				reports.add(r)
+			}
+		}
+		switch paramOutputFormat {
+		case OutputTable:
+		case OutputTSV:
+			rows.flush()
+		default:
+			reports.flush()
+		}
+		if failed {
+			os.Exit(1)
+		}
+	},
+}
+
+func lintSubs(file string) (r lintReport) {
+	r.File = file
+	r.Diagnostics = []osdb.Diagnostic{}
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		r.Error = err.Error()
+		return
+	}
+	doc, err := osdb.ParseBytes(data)
+	if err != nil {
+		r.Error = err.Error()
+		return
+	}
+
+	if !paramLintFix {
+		r.Diagnostics = append(r.Diagnostics, doc.Lint(lintOpts)...)
+		return
+	}
+
+	fixed, diags := doc.Fix(lintOpts)
+	r.Fixed = diags
+	r.Diagnostics = append(r.Diagnostics, fixed.Lint(lintOpts)...)
+	if len(diags) > 0 {
+		buf := new(bytes.Buffer)
+		fixed.Write(buf) // in the input format
+		if err := ioutil.WriteFile(file, buf.Bytes(), 0644); err != nil {
+			r.Error = err.Error()
+		}
+	}
+	return
+}
+
+// Add a row per diagnostic of a file, or for its error.
+func addLintRows(rows *printer, r lintReport) {
+	if r.Error != "" {
+		rows.add(nil, r.File, "", "", osdb.SeverityError.String(), "", r.Error, "")
+	}
+	for _, list := range []struct {
+		diags []osdb.Diagnostic
+		fixed string
+	}{{r.Fixed, "true"}, {r.Diagnostics, "false"}} {
+		for _, d := range list.diags {
+			line := ""
+			if d.Line > 0 {
+				line = strconv.Itoa(d.Line)
+			}
+			rows.add(nil, r.File, strconv.Itoa(d.Cue), line,
+				d.Severity.String(), d.Code, d.Message, list.fixed)
+		}
+	}
+}
+
+func printLintReport(r lintReport) {
+	if r.Error != "" {
+		fmt.Printf("%s: Error: %s\n", r.File, r.Error)
+		return
+	}
+	for _, d := range r.Fixed {
+		fmt.Printf("%s: fixed %s\n", r.File, d)
+	}
+	for _, d := range r.Diagnostics {
+		fmt.Printf("%s: %s\n", r.File, d)
+	}
+	if len(r.Diagnostics) == 0 {
+		fmt.Printf("%s: OK\n", r.File)
+	}
+}
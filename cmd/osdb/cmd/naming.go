@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/oz/osdb"
+)
+
+// DefaultOutputTemplate names subtitles like Plex, Kodi or Jellyfin
+// expect them, e.g. "movie.en.srt", or "movie.en.hi.srt".
+const DefaultOutputTemplate = "{dir}/{base}.{lang2}.{hi}.{forced}.{format}"
+
+var (
+	paramOutput    = DefaultOutputTemplate
+	paramOutputDir string
+
+	templateFieldRe = regexp.MustCompile(`\{[a-z0-9]+\}`)
+	dotsRe          = regexp.MustCompile(`\.{2,}`)
+	unsafeNameRe    = regexp.MustCompile(`[/\\:*?"<>|]+`)
+)
+
+// Values of the fields of an output template.
+type nameFields struct {
+	dir     string
+	base    string
+	lang2   string
+	lang3   string
+	format  string
+	hi      bool
+	forced  bool
+	release string
+}
+
+// Fill an output template with fields. Empty fields leave no repeated
+// dots behind in the file name.
+func expandTemplate(tmpl string, f nameFields) string {
+	values := map[string]string{
+		"{dir}":     f.dir,
+		"{base}":    f.base,
+		"{lang2}":   f.lang2,
+		"{lang3}":   f.lang3,
+		"{format}":  f.format,
+		"{release}": unsafeNameRe.ReplaceAllString(f.release, "_"),
+	}
+	if f.hi {
+		values["{hi}"] = "hi"
+	}
+	if f.forced {
+		values["{forced}"] = "forced"
+	}
+	out := templateFieldRe.ReplaceAllStringFunc(tmpl, func(field string) string {
+		return values[field]
+	})
+
+	dir, name := filepath.Split(out)
+	name = dotsRe.ReplaceAllString(name, ".")
+	name = strings.Trim(name, ".")
+	return filepath.Join(dir, name)
+}
+
+// Output template fields for a video file, and a subtitle.
+func newNameFields(video string, sub *osdb.Subtitle, format string) nameFields {
+	video = localVideo(video)
+	dir := filepath.Dir(video)
+	if paramOutputDir != "" {
+		dir = paramOutputDir
+	}
+	lang3 := strings.ToLower(sub.SubLanguageID)
+	lang2 := strings.ToLower(sub.ISO639)
+	if lang2 == "" {
+		lang2 = lang3
+	}
+	if format == "" {
+		format = strings.ToLower(sub.SubFormat)
+	}
+	if format == "" {
+		format = "srt"
+	}
+	return nameFields{
+		dir:     dir,
+		base:    strings.TrimSuffix(filepath.Base(video), filepath.Ext(video)),
+		lang2:   lang2,
+		lang3:   lang3,
+		format:  format,
+		hi:      sub.SubHearingImpaired == "1" && !paramStripHI,
+		forced:  sub.SubForeignPartsOnly == "1",
+		release: sub.MovieReleaseName,
+	}
+}
+
+// Path to save a subtitle for a video, from --output and --output-dir.
+// An empty format uses the subtitle's own.
+func subtitlePath(video string, sub *osdb.Subtitle, format string) string {
+	return expandTemplate(paramOutput, newNameFields(video, sub, format))
+}
@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/oz/osdb"
+)
+
+func TestExpandTemplate(t *testing.T) {
+	fields := nameFields{
+		dir:     "movies",
+		base:    "movie",
+		lang2:   "en",
+		lang3:   "eng",
+		format:  "srt",
+		release: "Movie.2016/Director's: Cut?",
+	}
+	hi, forced := fields, fields
+	hi.hi, forced.forced = true, true
+
+	for _, tt := range []struct {
+		name   string
+		tmpl   string
+		fields nameFields
+		path   string
+	}{
+		{"default", DefaultOutputTemplate, fields, "movies/movie.en.srt"},
+		{"hearing impaired", DefaultOutputTemplate, hi, "movies/movie.en.hi.srt"},
+		{"forced", DefaultOutputTemplate, forced, "movies/movie.en.forced.srt"},
+		{"lang3", "{dir}/{base}.{lang3}.{format}", fields, "movies/movie.eng.srt"},
+		{"release", "{dir}/{release}.{format}", fields, "movies/Movie.2016_Director's_ Cut_.srt"},
+		{"empty fields", "{dir}/{base}..{hi}.{forced}..{format}.", fields, "movies/movie.srt"},
+		{"unknown field", "{dir}/{base}.{nope}.{format}", fields, "movies/movie.srt"},
+		{"sub-directory", "{dir}/{lang2}/{base}.{format}", fields, "movies/en/movie.srt"},
+	} {
+		if path := expandTemplate(tt.tmpl, tt.fields); path != filepath.FromSlash(tt.path) {
+			t.Errorf("%s: expected %s, got %s", tt.name, tt.path, path)
+		}
+	}
+}
+
+func TestSubtitlePath(t *testing.T) {
+	defer func(dir string, strip bool) { paramOutputDir, paramStripHI = dir, strip }(paramOutputDir, paramStripHI)
+
+	for _, tt := range []struct {
+		name    string
+		video   string
+		sub     osdb.Subtitle
+		format  string
+		dir     string
+		stripHI bool
+		path    string
+	}{
+		{"default", "movies/movie.avi", osdb.Subtitle{SubLanguageID: "eng", ISO639: "en", SubFormat: "SRT"}, "", "", false, "movies/movie.en.srt"},
+		{"no ISO639", "movies/movie.avi", osdb.Subtitle{SubLanguageID: "pob", SubFormat: "srt"}, "", "", false, "movies/movie.pob.srt"},
+		{"no format", "movies/movie.avi", osdb.Subtitle{SubLanguageID: "eng", ISO639: "en"}, "", "", false, "movies/movie.en.srt"},
+		{"format", "movies/movie.avi", osdb.Subtitle{SubLanguageID: "eng", ISO639: "en", SubFormat: "srt"}, "ass", "", false, "movies/movie.en.ass"},
+		{"output dir", "movies/movie.avi", osdb.Subtitle{SubLanguageID: "eng", ISO639: "en"}, "", "subs", false, "subs/movie.en.srt"},
+		{"hearing impaired", "movie.avi", osdb.Subtitle{ISO639: "en", SubHearingImpaired: "1"}, "", "", false, "movie.en.hi.srt"},
+		{"stripped hearing impaired", "movie.avi", osdb.Subtitle{ISO639: "en", SubHearingImpaired: "1"}, "", "", true, "movie.en.srt"},
+		{"forced", "movie.avi", osdb.Subtitle{ISO639: "en", SubForeignPartsOnly: "1"}, "", "", false, "movie.en.forced.srt"},
+		{"remote video", "http://example.com/v/movie.mkv?x=1", osdb.Subtitle{ISO639: "en"}, "", "", false, "movie.en.srt"},
+		{"archive volume", "movies/movie.part1.rar", osdb.Subtitle{ISO639: "en"}, "", "", false, "movies/movie.en.srt"},
+	} {
+		paramOutputDir, paramStripHI = tt.dir, tt.stripHI
+		sub := tt.sub
+		if path := subtitlePath(tt.video, &sub, tt.format); path != filepath.FromSlash(tt.path) {
+			t.Errorf("%s: expected %s, got %s", tt.name, tt.path, path)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+// Output formats, for --output.
+const (
+	OutputTable  = "table"  // aligned columns, for humans
+	OutputTSV    = "tsv"    // tab-separated values, with a header line
+	OutputJSON   = "json"   // a single JSON array of records
+	OutputNDJSON = "ndjson" // one JSON record per line
+)
+
+var paramOutputFormat = OutputTable
+
+// Whether the output is meant for programs rather than humans.
+func machineOutput() bool {
+	return paramOutputFormat != OutputTable
+}
+
+// Where progress messages go: stdout for humans, stderr when stdout
+// carries machine-readable records.
+func logWriter() io.Writer {
+	if machineOutput() {
+		return os.Stderr
+	}
+	return os.Stdout
+}
+
+// Print a progress message.
+func logf(format string, args ...interface{}) {
+	printAboveProgress(func() {
+		fmt.Fprintf(logWriter(), format, args...)
+	})
+}
+
+// errorRecord is how errors are reported in JSON outputs.
+type errorRecord struct {
+	Error string `json:"error"`
+	File  string `json:"file,omitempty"`
+	ID    string `json:"id,omitempty"`
+}
+
+// A records printer, for all --output formats. JSON records are the
+// values given to add, while table and TSV use their row strings.
+type printer struct {
+	headers []string
+	rows    [][]string
+	records []interface{}
+}
+
+func newPrinter(headers ...string) *printer {
+	return &printer{headers: headers}
+}
+
+// Add a record. NDJSON records are printed right away.
+func (p *printer) add(record interface{}, row ...string) {
+	if paramOutputFormat == OutputNDJSON {
+		json.NewEncoder(os.Stdout).Encode(record)
+		return
+	}
+	p.records = append(p.records, record)
+	p.rows = append(p.rows, row)
+}
+
+// Print all the records.
+func (p *printer) flush() {
+	switch paramOutputFormat {
+	case OutputNDJSON:
+	case OutputJSON:
+		records := p.records
+		if records == nil {
+			records = []interface{}{}
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(records)
+	case OutputTSV:
+		fmt.Println(strings.Join(p.headers, "\t"))
+		for _, row := range p.rows {
+			for i := range row {
+				row[i] = strings.NewReplacer("\t", " ", "\n", " ").Replace(row[i])
+			}
+			fmt.Println(strings.Join(row, "\t"))
+		}
+	default:
+		w := new(tabwriter.Writer)
+		w.Init(os.Stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(w, strings.Join(p.headers, "\t"))
+		for _, row := range p.rows {
+			fmt.Fprintln(w, strings.Join(row, "\t"))
+		}
+		w.Flush()
+	}
+	p.records, p.rows = nil, nil
+}
+
+// Report a fatal error, as a record for machine outputs, and exit.
+func fail(err error) {
+	if machineOutput() {
+		json.NewEncoder(os.Stdout).Encode(errorRecord{Error: err.Error()})
+	} else {
+		fmt.Printf("Error: %s\n", err)
+	}
+	os.Exit(ExitFailure)
+}
@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Matches multi-part video names, e.g. "movie.cd1.avi", "movie-part2.mkv".
+var partRe = regexp.MustCompile(`(?i)^(.*?)(cd|part|pt|disc|disk)[ ._-]?(\d{1,2})([^\d].*)?$`)
+
+// Find the parts of a multi-part video, from its file name and its
+// siblings. Parts are returned in order, or nil if file is not part of
+// a complete set.
+func videoParts(file string) []string {
+	if isArchive(file) {
+		return nil // volumes are not video parts
+	}
+	m := partRe.FindStringSubmatch(path.Base(file))
+	if m == nil {
+		return nil
+	}
+	dir := path.Dir(file)
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+
+	found := map[int]string{}
+	for _, e := range entries {
+		o := partRe.FindStringSubmatch(e.Name())
+		if o == nil || e.IsDir() ||
+			!strings.EqualFold(o[1], m[1]) ||
+			!strings.EqualFold(o[2], m[2]) ||
+			!strings.EqualFold(o[4], m[4]) {
+			continue
+		}
+		n, _ := strconv.Atoi(o[3])
+		found[n] = path.Join(dir, e.Name())
+	}
+
+	parts := []string{}
+	for i := 1; i <= len(found); i++ {
+		p, ok := found[i]
+		if !ok {
+			return nil
+		}
+		parts = append(parts, p)
+	}
+	if len(parts) < 2 {
+		return nil
+	}
+	return parts
+}
@@ -0,0 +1,151 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/oz/osdb"
+)
+
+// Number of cues shown when previewing a candidate.
+const previewCues = 5
+
+var (
+	paramInteractive bool
+
+	stdin = bufio.NewReader(os.Stdin)
+)
+
+// Whether the user can answer questions on stdin.
+func isInteractive() bool {
+	if !paramInteractive {
+		return false
+	}
+	return isTerminal(os.Stdin)
+}
+
+// Choose a subtitle among candidates: the best one, or the user's pick
+// with --interactive. It also returns the chosen file when it was
+// downloaded for a preview, and a skipError when the user skips.
+func pickSubtitle(client *osdb.Client, subs osdb.Subtitles) (*osdb.Subtitle, *osdb.SubtitleFile, error) {
+	best := subs.Best() // sorts subs
+	if best == nil || len(subs) == 1 || !isInteractive() {
+		return best, nil, nil
+	}
+
+	previews := map[int]*osdb.SubtitleFile{}
+	printCandidates(subs)
+	for {
+		logf("Pick a subtitle [1], p<n> to preview, s to skip: ")
+		answer, err := stdin.ReadString('\n')
+		if err != nil {
+			// No more input: behave like a non-interactive run.
+			logf("\n")
+			return best, previews[0], nil
+		}
+		answer = strings.ToLower(strings.TrimSpace(answer))
+
+		switch {
+		case answer == "":
+			return best, previews[0], nil
+		case answer == "s":
+			return nil, nil, &skipError{"skipped by user"}
+		case strings.HasPrefix(answer, "p"):
+			i, ok := candidateIndex(strings.TrimPrefix(answer, "p"), len(subs))
+			if !ok {
+				continue
+			}
+			if paramDryRun {
+				logf("Can't preview with --dry-run.\n")
+				continue
+			}
+			if previews[i] == nil {
+				files, err := client.DownloadSubtitles(osdb.Subtitles{subs[i]})
+				if err != nil {
+					return nil, nil, err
+				}
+				if len(files) == 0 {
+					return nil, nil, fmt.Errorf("No file match this subtitle ID")
+				}
+				previews[i] = &files[0]
+			}
+			printPreview(previews[i])
+		default:
+			if i, ok := candidateIndex(answer, len(subs)); ok {
+				return &subs[i], previews[i], nil
+			}
+		}
+	}
+}
+
+// Parse a 1-based candidate number, into a 0-based index.
+func candidateIndex(s string, count int) (int, bool) {
+	n, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil || n < 1 || n > count {
+		logf("Invalid choice, pick between 1 and %d.\n", count)
+		return 0, false
+	}
+	return n - 1, true
+}
+
+func printCandidates(subs osdb.Subtitles) {
+	w := new(tabwriter.Writer)
+	w.Init(logWriter(), 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "#\tRELEASE\tUPLOADER\tRATING\tDOWNLOADS\tFLAGS\tFORMAT\tMATCH")
+	for i, s := range subs {
+		release := s.MovieReleaseName
+		if release == "" {
+			release = s.SubFileName
+		}
+		uploader := s.UserNickName
+		if uploader == "" {
+			uploader = "-"
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			i+1, release, uploader, s.SubRating, s.SubDownloadsCnt,
+			subtitleFlags(&s), s.SubFormat, s.MatchedBy)
+	}
+	w.Flush()
+}
+
+// Short flags for a subtitle: HI, trusted, forced, etc.
+func subtitleFlags(s *osdb.Subtitle) string {
+	flags := []string{}
+	if s.SubHearingImpaired == "1" {
+		flags = append(flags, "HI")
+	}
+	if s.SubFromTrusted == "1" {
+		flags = append(flags, "trusted")
+	}
+	if s.SubForeignPartsOnly == "1" {
+		flags = append(flags, "forced")
+	}
+	if s.SubHD == "1" {
+		flags = append(flags, "HD")
+	}
+	if s.CDCount() > 1 {
+		flags = append(flags, fmt.Sprintf("%dCD", s.CDCount()))
+	}
+	if len(flags) == 0 {
+		return "-"
+	}
+	return strings.Join(flags, ",")
+}
+
+func printPreview(sf *osdb.SubtitleFile) {
+	doc, err := sf.Parse()
+	if err != nil {
+		logf("Can't preview: %s\n", err)
+		return
+	}
+	for i, c := range doc.Cues {
+		if i == previewCues {
+			break
+		}
+		logf("  %s  %s\n", c.Start, strings.Join(c.Lines, " / "))
+	}
+}
@@ -0,0 +1,330 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"sync"
+
+	"github.com/oz/osdb"
+)
+
+// DefaultJobs is the default number of parallel workers, for --jobs.
+const DefaultJobs = 4
+
+var paramJobs = DefaultJobs
+
+// A video file to get subtitles for, in a language. Jobs go through
+// the stages of the get pipeline: hashing in parallel, searching in
+// batches, picking subtitles in order, then downloading in batches.
+type getJob struct {
+	file string
+	lang string
+	res  fileResult
+	err  error
+
+	hash uint64
+	size int64
+	subs osdb.Subtitles
+
+	// The subtitle left to download, and where.
+	best *osdb.Subtitle
+	dest string
+}
+
+// Get subtitles for files, in all languages, resuming jobs from their
+// states in a previous run, if any. Jobs are returned in the order of
+// files and languages, whatever the order they completed in.
+func runGetJobs(client *osdb.Client, files []string, states map[string]journalRecord) []*getJob {
+	jobs := []*getJob{}
+	for _, file := range files {
+		for _, lang := range paramLangs {
+			j := &getJob{
+				file: file,
+				lang: lang,
+				res:  fileResult{File: file, Lang: lang},
+			}
+			if s, ok := states[partKey(file, lang)]; ok {
+				j.resume(s)
+			}
+			jobs = append(jobs, j)
+		}
+	}
+
+	hashJobs(jobs)
+	searchJobs(client, jobs)
+	for _, j := range jobs {
+		if j.err != nil || j.best != nil {
+			continue
+		}
+		pickJob(client, j)
+		if j.best != nil {
+			getJournal.record(j, JobPicked)
+		} else {
+			getJournal.finish(j)
+		}
+	}
+	downloadJobs(client, jobs)
+	return jobs
+}
+
+// Hash the files of jobs that need it, each file once.
+func hashJobs(jobs []*getJob) {
+	files := []string{}
+	byFile := map[string][]*getJob{}
+	for _, j := range runningJobs(jobs) {
+		if skipExisting() {
+			if existing := existingSubtitle(j.file, j.lang); existing != "" {
+				j.err = &skipError{fmt.Sprintf("%s already exists", existing)}
+				getJournal.finish(j)
+				continue
+			}
+		}
+		if j.hash != 0 {
+			continue // from a previous run
+		}
+		if byFile[j.file] == nil {
+			files = append(files, j.file)
+		}
+		byFile[j.file] = append(byFile[j.file], j)
+	}
+
+	p := newProgress("Hashing", len(files))
+	defer p.finish()
+	parallel(len(files), func(i int) {
+		hash, size, err := fileHash(files[i])
+		for _, j := range byFile[files[i]] {
+			j.hash, j.size, j.err = hash, size, err
+			if err != nil {
+				getJournal.finish(j)
+			} else {
+				getJournal.record(j, JobHashed)
+			}
+		}
+		p.step()
+	})
+}
+
+// Search subtitles for the jobs still running, many jobs per call.
+func searchJobs(client *osdb.Client, jobs []*getJob) {
+	todo := []*getJob{}
+	for _, j := range runningJobs(jobs) {
+		if j.best == nil {
+			todo = append(todo, j)
+		}
+	}
+	p := newProgress("Searching", len(todo))
+	defer p.finish()
+
+	batches := batchJobs(todo, osdb.SearchBatchSize)
+	parallel(len(batches), func(i int) {
+		batch := batches[i]
+		queries := make([]osdb.HashQuery, len(batch))
+		for k, j := range batch {
+			queries[k] = osdb.HashQuery{Hash: j.hash, Size: j.size, Langs: []string{j.lang}}
+		}
+		results, err := client.BatchHashSearch(queries)
+		for k, j := range batch {
+			if err != nil {
+				j.err = err
+				getJournal.finish(j)
+			} else {
+				j.subs = results[k]
+				getJournal.record(j, JobSearched)
+			}
+			p.step()
+		}
+	})
+}
+
+// Pick the subtitle of a job, and check where it goes. Multi-CD
+// subtitles, and subtitles downloaded for a preview are saved right
+// away, others are left for downloadJobs.
+func pickJob(client *osdb.Client, j *getJob) {
+	if j.err != nil {
+		return
+	}
+	if j.err = downloadsStopped(); j.err != nil {
+		return
+	}
+	defer func() { quotaExceeded(j.err) }()
+	if doneParts[partKey(j.file, j.lang)] {
+		j.err = &skipError{"saved with another CD"}
+		return
+	}
+	logf("- Getting %s subtitles for file: %s\n", j.lang, path.Base(j.file))
+
+	best, previewed, err := pickSubtitle(client, j.subs)
+	if err != nil {
+		j.err = err
+		return
+	}
+	if best == nil {
+		j.err = NoSub
+		return
+	}
+	if best.CDCount() > 1 {
+		j.err = getMultiCDSubs(client, j.file, j.lang, best, j.subs, &j.res)
+		return
+	}
+	dest := subtitlePath(j.file, best, outputFormat())
+	if j.err = checkDest(dest); j.err != nil {
+		return
+	}
+	switch {
+	case paramDryRun:
+		logf("- Would download %s to: %s\n", best.IDSubtitleFile, dest)
+		j.res.saved(best.IDSubtitleFile, dest)
+	case previewed != nil:
+		logf("- Saving to: %s\n", dest)
+		if j.err = saveSubtitleFile(previewed, dest); j.err == nil {
+			j.res.saved(best.IDSubtitleFile, dest)
+		}
+	default:
+		j.best, j.dest = best, dest
+	}
+}
+
+// Download and save the picked subtitles, in batches.
+func downloadJobs(client *osdb.Client, jobs []*getJob) {
+	todo := []*getJob{}
+	for _, j := range runningJobs(jobs) {
+		if j.best != nil {
+			todo = append(todo, j)
+		}
+	}
+	if len(todo) == 0 {
+		return
+	}
+	// Cached files don't count in the quota.
+	needed := 0
+	for _, j := range todo {
+		if !client.Cache.HasFile(j.best.IDSubtitleFile) {
+			needed++
+		}
+	}
+	left := -1
+	if needed > 0 {
+		left = checkQuota(client, needed)
+	}
+	if left >= 0 && left < needed {
+		kept := todo[:0]
+		for _, j := range todo {
+			if !client.Cache.HasFile(j.best.IDSubtitleFile) {
+				if left == 0 {
+					j.err = client.QuotaError("no downloads left")
+					getJournal.finish(j)
+					continue
+				}
+				left--
+			}
+			kept = append(kept, j)
+		}
+		todo = kept
+	}
+	p := newProgress("Downloading", len(todo))
+	defer p.finish()
+
+	batches := batchJobs(todo, osdb.DownloadBatchSize)
+	parallel(len(batches), func(i int) {
+		batch := batches[i]
+		if err := downloadsStopped(); err != nil {
+			for _, j := range batch {
+				j.err = err
+				getJournal.finish(j)
+				p.step()
+			}
+			return
+		}
+		subs := make(osdb.Subtitles, len(batch))
+		for k, j := range batch {
+			subs[k] = *j.best
+		}
+		for k, r := range client.BatchDownloadSubtitles(subs) {
+			j := batch[k]
+			if j.err = r.Err; j.err == nil {
+				logf("- Downloading to: %s\n", j.dest)
+				if j.err = saveSubtitleFile(r.File, j.dest); j.err == nil {
+					j.res.saved(j.best.IDSubtitleFile, j.dest)
+				}
+			}
+			quotaExceeded(j.err)
+			getJournal.finish(j)
+			p.step()
+		}
+	})
+}
+
+// Cut jobs in batches of size items.
+func batchJobs(jobs []*getJob, size int) [][]*getJob {
+	batches := [][]*getJob{}
+	for len(jobs) > 0 {
+		n := size
+		if n > len(jobs) {
+			n = len(jobs)
+		}
+		batches = append(batches, jobs[:n])
+		jobs = jobs[n:]
+	}
+	return batches
+}
+
+// Jobs without errors so far.
+func runningJobs(jobs []*getJob) []*getJob {
+	running := []*getJob{}
+	for _, j := range jobs {
+		if j.err == nil {
+			running = append(running, j)
+		}
+	}
+	return running
+}
+
+// Call fn(0) to fn(n-1) from up to paramJobs goroutines, and wait for
+// all of them.
+func parallel(n int, fn func(i int)) {
+	workers := paramJobs
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > n {
+		workers = n
+	}
+	next := make(chan int)
+	wg := sync.WaitGroup{}
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				fn(i)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+}
+
+// Hash a local or remote file, and get its size.
+func fileHash(file string) (hash uint64, size int64, err error) {
+	if isURL(file) {
+		return osdb.HashURL(file)
+	}
+	if isArchive(file) {
+		return osdb.HashArchive(file)
+	}
+	fh, err := os.Open(file)
+	if err != nil {
+		return
+	}
+	defer fh.Close()
+	fi, err := fh.Stat()
+	if err != nil {
+		return
+	}
+	hash, err = getHashCache().HashFile(fh)
+	return hash, fi.Size(), err
+}
@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+var paramProgress = true
+
+// The progress line of a pipeline stage, with an ETA. It is only drawn
+// when stderr is a terminal, and log messages are printed above it.
+type progress struct {
+	stage string
+	total int
+	done  int
+	start time.Time
+}
+
+var (
+	progressMu     sync.Mutex
+	activeProgress *progress
+)
+
+// Start a stage of total steps.
+func newProgress(stage string, total int) *progress {
+	p := &progress{stage: stage, total: total, start: time.Now()}
+	if paramProgress && isTerminal(os.Stderr) {
+		progressMu.Lock()
+		activeProgress = p
+		p.draw()
+		progressMu.Unlock()
+	}
+	return p
+}
+
+// Count a finished step.
+func (p *progress) step() {
+	progressMu.Lock()
+	defer progressMu.Unlock()
+	p.done++
+	if activeProgress == p {
+		p.draw()
+	}
+}
+
+// Erase the progress line, at the end of the stage.
+func (p *progress) finish() {
+	progressMu.Lock()
+	defer progressMu.Unlock()
+	if activeProgress == p {
+		fmt.Fprint(os.Stderr, "\r\033[K")
+		activeProgress = nil
+	}
+}
+
+func (p *progress) draw() {
+	eta := "?"
+	if p.done > 0 {
+		left := time.Since(p.start) / time.Duration(p.done) * time.Duration(p.total-p.done)
+		eta = left.Round(time.Second).String()
+	}
+	fmt.Fprintf(os.Stderr, "\r\033[K%s %d/%d, ETA %s", p.stage, p.done, p.total, eta)
+}
+
+// Print a message above the progress line, if any.
+func printAboveProgress(print func()) {
+	progressMu.Lock()
+	defer progressMu.Unlock()
+	if activeProgress != nil {
+		fmt.Fprint(os.Stderr, "\r\033[K")
+	}
+	print()
+	if activeProgress != nil {
+		activeProgress.draw()
+	}
+}
+
+// Whether f is a terminal.
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"os"
 
@@ -10,50 +11,95 @@ import (
 
 func init() {
 	putCmd.Flags().StringVarP(&paramLang, "lang", "l", GetEnvLang(), "Subtitle language")
+	putCmd.Flags().BoolVarP(&paramDryRun, "dry-run", "n", false, "Build and check the upload, without uploading")
 	RootCmd.AddCommand(putCmd)
 }
 
+// The outcome of an upload, as printed by put.
+type putRecord struct {
+	MovieFile string `json:"movie_file"`
+	SubFile   string `json:"sub_file"`
+	Status    string `json:"status"`
+	URL       string `json:"url,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// Upload statuses, for putRecord.
+const (
+	PutUploaded = "uploaded"
+	PutValid    = "valid" // with --dry-run
+	PutExists   = "exists"
+	PutFailed   = "failed"
+)
+
+var errSubsExist = fmt.Errorf("these subtitles already exist")
+
 var putCmd = &cobra.Command{
 	Use:   "put [movie_file] [sub_file]",
 	Short: "Upload subtitles for a file",
-	Long:  `Submit new subtitles for a file.`,
+	Long: `Submit new subtitles for a file.
+
+With --dry-run, the upload is built and checked with OSDB, but not sent.`,
 	PreRun: func(cmd *cobra.Command, args []string) {
 		if len(args) != 2 {
-			fmt.Println("Invalid parameters.")
-			os.Exit(1)
+			fail(errors.New("invalid parameters"))
 		}
 	},
 	Run: func(cmd *cobra.Command, args []string) {
+		r := putRecord{MovieFile: args[0], SubFile: args[1], Status: PutUploaded}
+		if paramDryRun {
+			r.Status = PutValid
+		}
 		client, err := InitClient(paramLangs[0])
+		if err == nil {
+			r.URL, err = putSubs(client, args[0], args[1])
+		}
 		if err != nil {
-			fmt.Printf("Error: %s\n", err)
+			r.Status, r.Error = PutFailed, err.Error()
+			if err == errSubsExist {
+				r.Status = PutExists
+			}
+			logf("Error: %s\n", err)
+		}
+		if machineOutput() {
+			out := newPrinter("MOVIE", "SUBTITLE", "STATUS", "URL", "ERROR")
+			out.add(r, r.MovieFile, r.SubFile, r.Status, r.URL, r.Error)
+			out.flush()
 		}
-		if err := putSubs(client, args[0], args[1]); err != nil {
-			fmt.Printf("Error: %s\n", err)
+		if r.Status == PutFailed {
+			os.Exit(ExitFailure)
 		}
 	},
 }
 
-func putSubs(client *osdb.Client, movieFile string, subFile string) (err error) {
-	fmt.Println("- Checking subtitle with OSDB...")
+func putSubs(client *osdb.Client, movieFile string, subFile string) (subURL string, err error) {
+	logf("- Checking subtitle with OSDB...\n")
 	subs, err := osdb.NewSubtitles(movieFile, []string{subFile}, paramLang)
 	if err != nil {
 		return
 	}
+	if err = subs.ValidateUpload(); err != nil {
+		return
+	}
 
 	alreadyInDb, err := client.HasSubtitles(subs)
 	if err != nil {
 		return
 	}
 	if alreadyInDb == true {
-		return fmt.Errorf("these subtitles already exist")
+		return "", errSubsExist
+	}
+
+	if paramDryRun {
+		logf("- Subtitles are valid, and not in OSDB yet\n")
+		return
 	}
 
-	fmt.Println("- Uploading...")
-	subURL, err := client.UploadSubtitles(subs)
+	logf("- Uploading...\n")
+	subURL, err = client.UploadSubtitles(subs)
 	if err != nil {
 		return
 	}
-	fmt.Printf("- Subtitles uploaded to %s\n", subURL)
+	logf("- Subtitles uploaded to %s\n", subURL)
 	return
 }
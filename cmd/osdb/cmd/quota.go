@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/oz/osdb"
+)
+
+var (
+	paramQueue     string
+	paramFilesFrom string
+)
+
+// Set once the download quota is used: no more downloads are tried.
+var (
+	limitMu  sync.Mutex
+	limitErr *osdb.DownloadLimitError
+)
+
+// Tell whether err means that the download quota is used, and stop all
+// further downloads if so.
+func quotaExceeded(err error) bool {
+	lerr, ok := err.(*osdb.DownloadLimitError)
+	if !ok {
+		return false
+	}
+	limitMu.Lock()
+	defer limitMu.Unlock()
+	if limitErr == nil {
+		limitErr = lerr
+	}
+	return true
+}
+
+// The error that stopped downloads, if any.
+func downloadsStopped() error {
+	limitMu.Lock()
+	defer limitMu.Unlock()
+	if limitErr == nil {
+		return nil
+	}
+	return limitErr
+}
+
+// Read the download quota, and warn when it is too low for needed
+// downloads. It returns the number of downloads left, or -1 when
+// unknown.
+func checkQuota(client *osdb.Client, needed int) int {
+	q, err := client.Quota()
+	if err != nil {
+		logf("Warning: can't read the download quota: %s\n", err)
+		return -1
+	}
+	left := q.Remaining()
+	if left < 0 {
+		return left
+	}
+	logf("- Download quota: %d of %d left, for %d subtitles\n", left, q.Limit, needed)
+	if left < needed {
+		logf("Warning: only the first %d subtitles can be downloaded\n", left)
+	}
+	return left
+}
+
+// Report that downloads were stopped by the quota, and append the files
+// left to process to the --queue file.
+func reportQuotaStop(left []string) {
+	err := downloadsStopped()
+	if err == nil {
+		return
+	}
+	logf("Error: %s\n", err)
+	if paramQueue == "" || len(left) == 0 {
+		return
+	}
+	fh, err := os.OpenFile(paramQueue, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err == nil {
+		for _, file := range left {
+			fmt.Fprintln(fh, file)
+		}
+		err = fh.Close()
+	}
+	if err != nil {
+		logf("Error: can't queue files: %s\n", err)
+		return
+	}
+	logf("- Queued %d files in %s, use --files-from %s to resume\n", len(left), paramQueue, paramQueue)
+}
+
+// Read file paths, one per line.
+func readFileList(list string) ([]string, error) {
+	fh, err := os.Open(list)
+	if err != nil {
+		return nil, err
+	}
+	defer fh.Close()
+	files := []string{}
+	scanner := bufio.NewScanner(fh)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			files = append(files, line)
+		}
+	}
+	return files, scanner.Err()
+}
@@ -0,0 +1,39 @@
+package cmd
+
+import (
+	"net/url"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var paramFromURL []string
+
+// Whether a video is a remote file, hashed with HTTP Range requests.
+func isURL(s string) bool {
+	return strings.HasPrefix(s, "http://") || strings.HasPrefix(s, "https://")
+}
+
+// Volume numbers of RAR archives, e.g. ".part1" in "movie.part1.rar".
+var volumeRe = regexp.MustCompile(`(?i)\.part\d+(\.rar)$`)
+
+// The local path standing for a video, to name its subtitles: remote
+// videos map to their file name, in the current directory, and archive
+// volumes to the archive name, e.g. "movie.rar" for "movie.part1.rar".
+func localVideo(video string) string {
+	if isArchive(video) {
+		return volumeRe.ReplaceAllString(video, "$1")
+	}
+	if !isURL(video) {
+		return video
+	}
+	name := path.Base(video)
+	if u, err := url.Parse(video); err == nil {
+		name = path.Base(u.Path)
+	}
+	if name == "/" || name == "." {
+		name = "video"
+	}
+	return filepath.Join(".", name)
+}
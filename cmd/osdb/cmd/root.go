@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"fmt"
 	"os"
 	"strings"
 
@@ -20,6 +21,10 @@ var (
 	paramLangs []string
 )
 
+func init() {
+	RootCmd.PersistentFlags().StringVarP(&paramOutputFormat, "output", "o", OutputTable, "Output format: table, tsv, json or ndjson")
+}
+
 // RootCmd is the main OSDB program command.
 var RootCmd = &cobra.Command{
 	Use:   "osdb",
@@ -27,6 +32,11 @@ var RootCmd = &cobra.Command{
 	Long:  "Search and download subtitles from the command-line.",
 	PersistentPreRun: func(c *cobra.Command, args []string) {
 		paramLangs = strings.Split(paramLang, ",")
+		switch paramOutputFormat {
+		case OutputTable, OutputTSV, OutputJSON, OutputNDJSON:
+		default:
+			fail(fmt.Errorf("invalid --output format %q", paramOutputFormat))
+		}
 	},
 	Run: func(c *cobra.Command, args []string) {
 	},
@@ -38,6 +48,7 @@ func InitClient(lang string) (client *osdb.Client, err error) {
 	if client, err = osdb.NewClient(); err != nil {
 		return
 	}
+	client.Cache = responseCache()
 	if err = client.LogIn(os.Getenv("OSDB_LOGIN"), os.Getenv("OSDB_PASSWORD"), lang); err != nil {
 		return
 	}
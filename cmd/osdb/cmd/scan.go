@@ -0,0 +1,157 @@
+package cmd
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/h2non/filetype"
+)
+
+// Symbolic links policies, for --symlinks.
+const (
+	SymlinksSkip   = "skip"   // ignore all symbolic links
+	SymlinksFiles  = "files"  // follow links to files, not to directories
+	SymlinksFollow = "follow" // follow all links
+)
+
+// Number of header bytes needed to sniff a file type.
+const sniffLen = 262
+
+// Well-known extensions, checked before sniffing file contents.
+var (
+	videoExts = map[string]bool{
+		".3gp": true, ".asf": true, ".avi": true, ".divx": true,
+		".flv": true, ".m2ts": true, ".m4v": true, ".mkv": true,
+		".mov": true, ".mp4": true, ".mpeg": true, ".mpg": true,
+		".mts": true, ".ogm": true, ".ogv": true, ".rm": true,
+		".rmvb": true, ".ts": true, ".vob": true, ".webm": true,
+		".wmv": true, ".xvid": true,
+	}
+	otherExts = map[string]bool{
+		".ass": true, ".bak": true, ".idx": true, ".jpg": true,
+		".jpeg": true, ".json": true, ".md": true, ".mp3": true,
+		".nfo": true, ".png": true, ".sfv": true, ".srt": true,
+		".ssa": true, ".sub": true, ".txt": true, ".vtt": true,
+		".xml": true, ".flac": true, ".par2": true,
+	}
+)
+
+// Archives given on the command-line are hashed through the video they
+// store, see osdb.OpenArchive.
+var archiveExts = map[string]bool{".rar": true, ".zip": true}
+
+// Options for directory scans, from the command-line.
+type scanOptions struct {
+	recursive bool
+	maxDepth  int      // with recursive, 0 means unlimited
+	include   []string // globs for files to scan, all when empty
+	exclude   []string // globs for files and directories to skip
+	symlinks  string
+}
+
+var scanOpts = scanOptions{symlinks: SymlinksFiles}
+
+// List video files in a directory, following scanOpts.
+func getFilesFromPath(dir string) []string {
+	files := []string{}
+	visited := map[string]bool{}
+	scanDir(dir, dir, 1, visited, &files)
+	return files
+}
+
+func scanDir(root string, dir string, depth int, visited map[string]bool, files *[]string) {
+	if real, err := filepath.EvalSymlinks(dir); err == nil {
+		if visited[real] {
+			return // symlink loop
+		}
+		visited[real] = true
+	}
+
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		logf("Warning: %s\n", err)
+		return
+	}
+	for _, e := range entries {
+		file := filepath.Join(dir, e.Name())
+		rel, _ := filepath.Rel(root, file)
+		if matchAny(scanOpts.exclude, e.Name(), rel) {
+			continue
+		}
+
+		fi := os.FileInfo(e)
+		if e.Mode()&os.ModeSymlink != 0 {
+			if scanOpts.symlinks == SymlinksSkip {
+				continue
+			}
+			if fi, err = os.Stat(file); err != nil {
+				continue // dangling link
+			}
+			if fi.IsDir() && scanOpts.symlinks != SymlinksFollow {
+				continue
+			}
+		}
+
+		if fi.IsDir() {
+			if scanOpts.recursive && (scanOpts.maxDepth == 0 || depth < scanOpts.maxDepth) {
+				scanDir(root, file, depth+1, visited, files)
+			}
+			continue
+		}
+		if !fi.Mode().IsRegular() {
+			continue
+		}
+		if len(scanOpts.include) > 0 && !matchAny(scanOpts.include, e.Name(), rel) {
+			continue
+		}
+		if isVideo(file) {
+			*files = append(*files, file)
+		}
+	}
+}
+
+// Match a file's name, or path relative to the scanned directory, with
+// globs.
+func matchAny(globs []string, name string, rel string) bool {
+	for _, g := range globs {
+		if ok, _ := filepath.Match(g, name); ok {
+			return true
+		}
+		if ok, _ := filepath.Match(g, filepath.ToSlash(rel)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Tell whether file is a video, from its extension, or by sniffing its
+// first bytes when the extension is unknown.
+func isVideo(file string) bool {
+	ext := strings.ToLower(filepath.Ext(file))
+	if videoExts[ext] {
+		return true
+	}
+	if otherExts[ext] {
+		return false
+	}
+
+	fh, err := os.Open(file)
+	if err != nil {
+		return false
+	}
+	defer fh.Close()
+	head := make([]byte, sniffLen)
+	n, err := io.ReadFull(fh, head)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return false
+	}
+	return filetype.IsVideo(head[:n])
+}
+
+// Tell whether file is a RAR or ZIP archive, from its extension.
+func isArchive(file string) bool {
+	return archiveExts[strings.ToLower(filepath.Ext(file))]
+}
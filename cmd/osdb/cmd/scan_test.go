@@ -0,0 +1,126 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// Build a directory to scan:
+//
+//	a.mkv, notes.txt, sniff (an MP4 without extension)
+//	link.mkv -> a.mkv
+//	sub/b.avi
+//	sub/deep/c.mp4
+//	sub/deep/up -> .. (a symlink loop)
+//	linkdir -> sub
+func writeScanTree(t *testing.T, dir string) {
+	if err := os.MkdirAll(filepath.Join(dir, "sub", "deep"), 0755); err != nil {
+		t.Fatalf("Can't create directories: %s", err)
+	}
+	for name, data := range map[string]string{
+		"a.mkv":          "video",
+		"notes.txt":      "text",
+		"sniff":          "\x00\x00\x00\x18ftypisom\x00\x00\x02\x00isomiso2avc1mp41",
+		"sub/b.avi":      "video",
+		"sub/deep/c.mp4": "video",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatalf("Can't write %s: %s", name, err)
+		}
+	}
+	for link, target := range map[string]string{
+		"link.mkv":    "a.mkv",
+		"linkdir":     "sub",
+		"sub/deep/up": "..",
+	} {
+		if err := os.Symlink(target, filepath.Join(dir, link)); err != nil {
+			t.Fatalf("Can't create link %s: %s", link, err)
+		}
+	}
+}
+
+func TestGetFilesFromPath(t *testing.T) {
+	dir, done := tempDir(t)
+	defer done()
+	writeScanTree(t, dir)
+	defer func(opts scanOptions) { scanOpts = opts }(scanOpts)
+
+	for _, tt := range []struct {
+		name  string
+		opts  scanOptions
+		files []string
+	}{
+		{
+			"not recursive",
+			scanOptions{symlinks: SymlinksFiles},
+			[]string{"a.mkv", "link.mkv", "sniff"},
+		},
+		{
+			"recursive",
+			scanOptions{recursive: true, symlinks: SymlinksFiles},
+			[]string{"a.mkv", "link.mkv", "sniff", "sub/b.avi", "sub/deep/c.mp4"},
+		},
+		{
+			"max depth",
+			scanOptions{recursive: true, maxDepth: 2, symlinks: SymlinksFiles},
+			[]string{"a.mkv", "link.mkv", "sniff", "sub/b.avi"},
+		},
+		{
+			"skip symlinks",
+			scanOptions{recursive: true, symlinks: SymlinksSkip},
+			[]string{"a.mkv", "sniff", "sub/b.avi", "sub/deep/c.mp4"},
+		},
+		{
+			// linkdir is scanned before sub, which is then known, and
+			// sub/deep/up loops back to it.
+			"follow symlinks",
+			scanOptions{recursive: true, symlinks: SymlinksFollow},
+			[]string{"a.mkv", "link.mkv", "linkdir/b.avi", "linkdir/deep/c.mp4", "sniff"},
+		},
+		{
+			"include",
+			scanOptions{recursive: true, include: []string{"*.avi", "sub/deep/*"}, symlinks: SymlinksFiles},
+			[]string{"sub/b.avi", "sub/deep/c.mp4"},
+		},
+		{
+			"exclude",
+			scanOptions{recursive: true, exclude: []string{"sub", "*.mkv"}, symlinks: SymlinksFiles},
+			[]string{"sniff"},
+		},
+	} {
+		scanOpts = tt.opts
+		files := []string{}
+		for _, file := range getFilesFromPath(dir) {
+			rel, _ := filepath.Rel(dir, file)
+			files = append(files, filepath.ToSlash(rel))
+		}
+		sort.Strings(files)
+		if !reflect.DeepEqual(files, tt.files) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.files, files)
+		}
+	}
+}
+
+func TestIsVideo(t *testing.T) {
+	dir, done := tempDir(t)
+	defer done()
+	writeScanTree(t, dir)
+
+	for _, tt := range []struct {
+		file  string
+		video bool
+	}{
+		{"a.mkv", true},
+		{"notes.txt", false},
+		{"sniff", true},
+		{"missing", false},
+	} {
+		if video := isVideo(filepath.Join(dir, tt.file)); video != tt.video {
+			t.Errorf("%s: expected video %v, got %v", tt.file, tt.video, video)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/oz/osdb"
+	"github.com/spf13/cobra"
+)
+
+var (
+	paramSearchHash    string
+	paramSearchSize    int64
+	paramSearchIMDB    string
+	paramSearchSeason  uint
+	paramSearchEpisode uint
+)
+
+func init() {
+	searchCmd.Flags().StringVarP(&paramLang, "lang", "l", GetEnvLang(), "Subtitle languages, comma-separated")
+	searchCmd.Flags().StringVar(&paramSearchHash, "hash", "", "Search by OSDB movie hash, with --size")
+	searchCmd.Flags().Int64Var(&paramSearchSize, "size", 0, "Movie size in bytes, with --hash")
+	searchCmd.Flags().StringVar(&paramSearchIMDB, "imdb", "", "Search by IMDB ID, e.g. tt0403358")
+	searchCmd.Flags().UintVar(&paramSearchSeason, "season", 0, "TV show season")
+	searchCmd.Flags().UintVar(&paramSearchEpisode, "episode", 0, "TV show episode")
+	RootCmd.AddCommand(searchCmd)
+}
+
+var searchCmd = &cobra.Command{
+	Use:   "search [file or query...]",
+	Short: "Search subtitles, without downloading them",
+	Long: `List subtitles matching a movie file, a hash (--hash and --size), an
+IMDB ID (--imdb), or a free-text query. Use "osdb download" to fetch
+some of them with their IDs.`,
+	PreRun: func(cmd *cobra.Command, args []string) {
+		if paramSearchHash != "" && paramSearchSize <= 0 {
+			fail(errors.New("--hash needs the movie --size, in bytes"))
+		}
+		if paramSearchHash == "" && cmd.Flags().Changed("size") {
+			fail(errors.New("--size is only used with --hash"))
+		}
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		client, err := InitClient(paramLangs[0])
+		if err != nil {
+			fail(err)
+		}
+		subs, err := searchSubs(client, args)
+		if err != nil {
+			fail(err)
+		}
+		if len(subs) == 0 {
+			logf("%s\n", NoSub)
+			if machineOutput() {
+				printSubtitles(subs)
+			}
+			os.Exit(ExitPartial)
+		}
+		printSubtitles(subs)
+	},
+}
+
+func searchSubs(client *osdb.Client, args []string) (osdb.Subtitles, error) {
+	switch {
+	case paramSearchHash != "":
+		hash, err := strconv.ParseUint(paramSearchHash, 16, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid hash %q", paramSearchHash)
+		}
+		return client.HashSearch(hash, paramSearchSize, paramLangs)
+	case paramSearchIMDB != "":
+		id := strings.TrimPrefix(strings.ToLower(paramSearchIMDB), "tt")
+		isMovie := paramSearchSeason == 0 && paramSearchEpisode == 0
+		return client.IMDBSearchByIDFiltered(id, isMovie, paramSearchSeason, paramSearchEpisode, paramLangs)
+	case len(args) == 1:
+		if fi, err := os.Stat(args[0]); err == nil && !fi.IsDir() {
+			client.HashCache = getHashCache()
+			defer saveHashCache()
+			return client.FileSearch(args[0], paramLangs)
+		}
+	}
+	if len(args) == 0 {
+		return nil, fmt.Errorf("missing file, query, --hash or --imdb")
+	}
+	return client.TextSearch(strings.Join(args, " "), paramSearchSeason, paramSearchEpisode, paramLangs)
+}
+
+// A subtitle, as printed by search.
+type subtitleRecord struct {
+	ID              string `json:"id"`
+	SubtitleID      string `json:"subtitle_id"`
+	IMDBID          string `json:"imdb_id"`
+	Lang            string `json:"lang"`
+	ISO639          string `json:"iso639"`
+	Movie           string `json:"movie"`
+	Year            string `json:"year"`
+	Release         string `json:"release"`
+	FileName        string `json:"file_name"`
+	Format          string `json:"format"`
+	Downloads       int    `json:"downloads"`
+	Rating          string `json:"rating"`
+	HearingImpaired bool   `json:"hearing_impaired"`
+	Trusted         bool   `json:"trusted"`
+	Forced          bool   `json:"forced"`
+	CDCount         int    `json:"cd_count"`
+	MatchedBy       string `json:"matched_by"`
+	Uploader        string `json:"uploader"`
+}
+
+func newSubtitleRecord(s *osdb.Subtitle) subtitleRecord {
+	downloads, _ := strconv.Atoi(s.SubDownloadsCnt)
+	return subtitleRecord{
+		ID:              s.IDSubtitleFile,
+		SubtitleID:      s.IDSubtitle,
+		IMDBID:          s.IDMovieImdb,
+		Lang:            s.SubLanguageID,
+		ISO639:          s.ISO639,
+		Movie:           s.MovieName,
+		Year:            s.MovieYear,
+		Release:         s.MovieReleaseName,
+		FileName:        s.SubFileName,
+		Format:          s.SubFormat,
+		Downloads:       downloads,
+		Rating:          s.SubRating,
+		HearingImpaired: s.SubHearingImpaired == "1",
+		Trusted:         s.SubFromTrusted == "1",
+		Forced:          s.SubForeignPartsOnly == "1",
+		CDCount:         s.CDCount(),
+		MatchedBy:       s.MatchedBy,
+		Uploader:        s.UserNickName,
+	}
+}
+
+func printSubtitles(subs osdb.Subtitles) {
+	out := newPrinter("ID", "LANG", "MOVIE", "RELEASE", "FORMAT", "DOWNLOADS", "RATING", "FLAGS", "MATCH")
+	for _, s := range subs {
+		movie := s.MovieName
+		if s.MovieYear != "" {
+			movie += " (" + s.MovieYear + ")"
+		}
+		release := s.MovieReleaseName
+		if release == "" {
+			release = s.SubFileName
+		}
+		out.add(newSubtitleRecord(&s),
+			s.IDSubtitleFile, s.SubLanguageID, movie, release, s.SubFormat,
+			s.SubDownloadsCnt, s.SubRating, subtitleFlags(&s), s.MatchedBy)
+	}
+	out.flush()
+}
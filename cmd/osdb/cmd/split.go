@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/oz/osdb"
+	"github.com/spf13/cobra"
+)
+
+var (
+	paramSplitAt     string
+	paramSplitVideos []string
+)
+
+func init() {
+	splitCmd.Flags().StringVar(&paramSplitAt, "at", "", "Comma-separated split times, e.g. 52m10s or 00:52:10,000")
+	splitCmd.Flags().StringSliceVar(&paramSplitVideos, "videos", nil, "Video parts, to split at their durations (needs ffprobe)")
+	RootCmd.AddCommand(splitCmd)
+}
+
+var splitCmd = &cobra.Command{
+	Use:   "split [sub_file]",
+	Short: "Split subtitles in parts",
+	Long: `Cut a subtitle file in parts, at given times, or at the durations of
+the parts of a multi-CD video. Each part is rebased to start at 0.
+
+Parts are saved next to the matching video parts, or as sub.cd1.srt,
+sub.cd2.srt, etc.`,
+	PreRun: func(cmd *cobra.Command, args []string) {
+		if len(args) != 1 || (paramSplitAt == "") == (len(paramSplitVideos) == 0) {
+			fmt.Println("Invalid parameters: need a subtitle file, and either --at or --videos.")
+			os.Exit(1)
+		}
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := splitSubs(args[0]); err != nil {
+			fmt.Printf("Error: %s\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+func splitSubs(file string) error {
+	doc, err := readDocument(file)
+	if err != nil {
+		return err
+	}
+
+	var parts []*osdb.Document
+	if paramSplitAt != "" {
+		at, err := parseTimes(paramSplitAt)
+		if err != nil {
+			return err
+		}
+		if parts, err = doc.Split(at); err != nil {
+			return err
+		}
+	} else {
+		durations, err := videoDurations(paramSplitVideos)
+		if err != nil {
+			return err
+		}
+		if parts, err = doc.SplitDurations(durations); err != nil {
+			return err
+		}
+	}
+
+	base := strings.TrimSuffix(file, path.Ext(file))
+	for i, part := range parts {
+		dest := fmt.Sprintf("%s.cd%d.srt", base, i+1)
+		if len(paramSplitVideos) > 0 {
+			video := paramSplitVideos[i]
+			dest = strings.TrimSuffix(video, path.Ext(video)) + ".srt"
+		}
+		fmt.Printf("- CD%d: %d cues to %s\n", i+1, len(part.Cues), dest)
+		if err := ioutil.WriteFile(dest, part.Bytes(), 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Read and parse a UTF-8 subtitle file.
+func readDocument(file string) (*osdb.Document, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := osdb.ParseBytes(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", file, err)
+	}
+	return doc, nil
+}
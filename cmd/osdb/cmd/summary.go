@@ -0,0 +1,126 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+// Exit codes of commands processing many files.
+const (
+	ExitOK      = 0 // every file was processed
+	ExitFailure = 1 // nothing succeeded
+	ExitPartial = 2 // some files are missing subtitles, or failed
+)
+
+// Outcomes of processing a file.
+const (
+	StatusFound   = "found"
+	StatusMissing = "missing"
+	StatusFailed  = "failed"
+	StatusSkipped = "skipped"
+)
+
+// skipError tells why a file was skipped.
+type skipError struct {
+	reason string
+}
+
+func (e *skipError) Error() string {
+	return e.reason
+}
+
+// The outcome of processing a file, for a language.
+type fileResult struct {
+	File        string   `json:"file"`
+	Lang        string   `json:"lang,omitempty"`
+	Status      string   `json:"status"`
+	SubtitleIDs []string `json:"subtitle_ids,omitempty"`
+	Paths       []string `json:"paths,omitempty"`
+	Detail      string   `json:"detail,omitempty"`
+	Error       string   `json:"error,omitempty"`
+}
+
+// Record a subtitle file in a result, once it is saved, or would be
+// with --dry-run.
+func (r *fileResult) saved(id string, path string) {
+	r.SubtitleIDs = append(r.SubtitleIDs, id)
+	r.Paths = append(r.Paths, path)
+}
+
+// Results of a command over many files.
+type summary struct {
+	results []fileResult
+	counts  map[string]int
+	out     *printer
+}
+
+func newSummary() *summary {
+	return &summary{
+		counts: map[string]int{},
+		out:    newPrinter("FILE", "LANG", "STATUS", "SUBTITLE", "PATH", "DETAIL"),
+	}
+}
+
+// Record the outcome of processing a file, from its error.
+func (s *summary) add(r fileResult, err error) {
+	r.Status = StatusFound
+	switch err.(type) {
+	case nil:
+	case *skipError:
+		r.Status = StatusSkipped
+		r.Detail = err.Error()
+	default:
+		r.Status = StatusFailed
+		r.Error = err.Error()
+		if err == NoSub {
+			r.Status = StatusMissing
+			r.Error = ""
+		}
+	}
+	s.results = append(s.results, r)
+	s.counts[r.Status]++
+	detail := r.Detail
+	if r.Error != "" {
+		detail = r.Error
+	}
+	s.out.add(r, r.File, r.Lang, r.Status,
+		strings.Join(r.SubtitleIDs, ","), strings.Join(r.Paths, ","), detail)
+}
+
+// Print counts per status, and the files that failed, or all the
+// results for machine outputs.
+func (s *summary) print() {
+	if machineOutput() {
+		s.out.flush()
+		return
+	}
+
+	w := new(tabwriter.Writer)
+	w.Init(os.Stdout, 0, 8, 1, ' ', 0)
+	fmt.Fprintln(w)
+	for _, r := range s.results {
+		if r.Status == StatusFailed {
+			fmt.Fprintf(w, "FAILED\t%s\t%s\t%s\n", r.Lang, r.File, r.Error)
+		}
+	}
+	fmt.Fprintf(w, "Found:\t%d\n", s.counts[StatusFound])
+	fmt.Fprintf(w, "Missing:\t%d\n", s.counts[StatusMissing])
+	fmt.Fprintf(w, "Failed:\t%d\n", s.counts[StatusFailed])
+	fmt.Fprintf(w, "Skipped:\t%d\n", s.counts[StatusSkipped])
+	w.Flush()
+}
+
+// Exit code reflecting the results: a failure when nothing was found,
+// although some files were not skipped.
+func (s *summary) exitCode() int {
+	notFound := s.counts[StatusFailed] + s.counts[StatusMissing]
+	switch {
+	case notFound > 0 && s.counts[StatusFound] == 0:
+		return ExitFailure
+	case s.counts[StatusFailed] > 0 || s.counts[StatusMissing] > 0:
+		return ExitPartial
+	}
+	return ExitOK
+}
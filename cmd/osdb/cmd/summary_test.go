@@ -0,0 +1,38 @@
+package cmd
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSummaryExitCode(t *testing.T) {
+	var (
+		found   error
+		missing = NoSub
+		failed  = errors.New("boom")
+		skipped = &skipError{"test"}
+	)
+	for _, tt := range []struct {
+		name    string
+		results []error
+		code    int
+	}{
+		{"nothing", nil, ExitOK},
+		{"all found", []error{found, found}, ExitOK},
+		{"all skipped", []error{skipped, skipped}, ExitOK},
+		{"found and skipped", []error{found, skipped}, ExitOK},
+		{"all missing", []error{missing, missing}, ExitFailure},
+		{"all failed", []error{failed}, ExitFailure},
+		{"missing, failed and skipped", []error{missing, failed, skipped}, ExitFailure},
+		{"found and missing", []error{found, missing}, ExitPartial},
+		{"found and failed", []error{found, failed}, ExitPartial},
+	} {
+		s := newSummary()
+		for _, err := range tt.results {
+			s.add(fileResult{File: "movie.avi", Lang: "eng"}, err)
+		}
+		if code := s.exitCode(); code != tt.code {
+			t.Errorf("%s: expected exit code %d, got %d", tt.name, tt.code, code)
+		}
+	}
+}
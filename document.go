@@ -0,0 +1,321 @@
+package osdb
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Subtitle formats understood by Parse.
+const (
+	FormatSRT = "srt"
+	FormatVTT = "vtt"
+)
+
+// Cue is a single subtitle entry: some lines of text shown on screen
+// between Start and End.
+type Cue struct {
+	Start time.Duration
+	End   time.Duration
+	Lines []string
+}
+
+// Duration of the cue on screen.
+func (c Cue) Duration() time.Duration {
+	return c.End - c.Start
+}
+
+// Text of the cue, lines joined with "\n".
+func (c Cue) Text() string {
+	return strings.Join(c.Lines, "\n")
+}
+
+// Document is a parsed subtitle file: an ordered list of cues.
+type Document struct {
+	Format string
+	Cues   []Cue
+}
+
+// ParseError reports a malformed subtitle file.
+type ParseError struct {
+	Line int
+	Msg  string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Msg)
+}
+
+var timingRe = regexp.MustCompile(
+	`^\s*((?:\d+:)?\d+:\d+[,.]\d+)\s*-->\s*((?:\d+:)?\d+:\d+[,.]\d+)`,
+)
+
+// Parse reads a SubRip (SRT) or WebVTT subtitle from UTF-8 text.
+func Parse(r io.Reader) (*Document, error) {
+	doc := &Document{Format: FormatSRT}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	var (
+		lineNo int
+		cue    *Cue
+		block  []string // lines seen in the current block, before timing
+	)
+	flush := func() {
+		if cue != nil {
+			doc.Cues = append(doc.Cues, *cue)
+			cue = nil
+		}
+		block = block[:0]
+	}
+
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if lineNo == 1 {
+			line = strings.TrimPrefix(line, string(bom))
+			if strings.HasPrefix(line, "WEBVTT") {
+				doc.Format = FormatVTT
+				continue
+			}
+		}
+
+		if strings.TrimSpace(line) == "" {
+			flush()
+			continue
+		}
+		if cue != nil {
+			cue.Lines = append(cue.Lines, line)
+			continue
+		}
+
+		m := timingRe.FindStringSubmatch(line)
+		if m == nil {
+			block = append(block, line)
+			// SRT blocks start with a counter, WebVTT ones with an
+			// optional identifier, or a NOTE/STYLE section to skip.
+			if doc.Format == FormatSRT && len(block) > 1 {
+				return nil, &ParseError{lineNo, "missing cue timing"}
+			}
+			continue
+		}
+		start, err := ParseTimestamp(m[1])
+		if err != nil {
+			return nil, &ParseError{lineNo, err.Error()}
+		}
+		end, err := ParseTimestamp(m[2])
+		if err != nil {
+			return nil, &ParseError{lineNo, err.Error()}
+		}
+		cue = &Cue{Start: start, End: end}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	flush()
+
+	return doc, nil
+}
+
+// ParseBytes parses a subtitle file from UTF-8 text.
+func ParseBytes(data []byte) (*Document, error) {
+	return Parse(bytes.NewReader(data))
+}
+
+// ParseTimestamp reads subtitle timestamps, such as "01:02:03,456",
+// "01:02:03.456" or "02:03.456". Minutes and seconds are required: a
+// bare number such as "5" is ambiguous, and rejected.
+func ParseTimestamp(s string) (time.Duration, error) {
+	invalid := fmt.Errorf("invalid timestamp %q", s)
+	t := strings.Replace(s, ",", ".", 1)
+	dot := strings.LastIndex(t, ".")
+	if dot < 0 {
+		t += ".000"
+		dot = len(t) - 4
+	}
+	parts := strings.Split(t[:dot], ":")
+	switch len(parts) {
+	case 2:
+		parts = append([]string{"0"}, parts...)
+	case 3:
+	default:
+		return 0, invalid
+	}
+
+	frac := t[dot+1:]
+	if !isDigits(frac) {
+		return 0, invalid
+	}
+	for len(frac) < 3 {
+		frac += "0"
+	}
+	ms, _ := strconv.Atoi(frac[:3])
+
+	var units = []time.Duration{time.Hour, time.Minute, time.Second}
+	d := time.Duration(ms) * time.Millisecond
+	for i, p := range parts {
+		if !isDigits(p) {
+			return 0, invalid
+		}
+		n, err := strconv.Atoi(p)
+		if err != nil {
+			return 0, invalid
+		}
+		d += time.Duration(n) * units[i]
+	}
+	return d, nil
+}
+
+// Whether s is a non-empty string of ASCII digits: no sign, no spaces.
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// Format a timestamp for SRT files, e.g. "01:02:03,456".
+func formatTimestamp(d time.Duration) string {
+	sign := ""
+	if d < 0 {
+		sign = "-"
+		d = -d
+	}
+	ms := d / time.Millisecond
+	return fmt.Sprintf("%s%02d:%02d:%02d,%03d",
+		sign, ms/3600000, ms/60000%60, ms/1000%60, ms%1000)
+}
+
+// WriteSRT writes the document in SubRip format, numbering cues from 1.
+func (d *Document) WriteSRT(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	for i, c := range d.Cues {
+		if i > 0 {
+			bw.WriteString("\n")
+		}
+		fmt.Fprintf(bw, "%d\n%s --> %s\n",
+			i+1, formatTimestamp(c.Start), formatTimestamp(c.End))
+		for _, l := range c.Lines {
+			bw.WriteString(l + "\n")
+		}
+	}
+	return bw.Flush()
+}
+
+// WriteVTT writes the document in WebVTT format. Cue settings, notes
+// and styles are not kept by Parse, so they are not written back.
+func (d *Document) WriteVTT(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString("WEBVTT\n")
+	for _, c := range d.Cues {
+		fmt.Fprintf(bw, "\n%s --> %s\n",
+			strings.Replace(formatTimestamp(c.Start), ",", ".", 1),
+			strings.Replace(formatTimestamp(c.End), ",", ".", 1))
+		for _, l := range c.Lines {
+			bw.WriteString(l + "\n")
+		}
+	}
+	return bw.Flush()
+}
+
+// Write writes the document in its own Format: WebVTT or SubRip.
+func (d *Document) Write(w io.Writer) error {
+	if d.Format == FormatVTT {
+		return d.WriteVTT(w)
+	}
+	return d.WriteSRT(w)
+}
+
+// Bytes returns the document in SubRip format.
+func (d *Document) Bytes() []byte {
+	buf := new(bytes.Buffer)
+	d.WriteSRT(buf)
+	return buf.Bytes()
+}
+
+// Shift returns a copy of the document, with all cues moved by offset.
+func (d *Document) Shift(offset time.Duration) *Document {
+	out := &Document{Format: d.Format, Cues: make([]Cue, len(d.Cues))}
+	for i, c := range d.Cues {
+		c.Start += offset
+		c.End += offset
+		out.Cues[i] = c
+	}
+	return out
+}
+
+// Join concatenates the parts of a subtitle, e.g. from a multi-CD
+// release, into a single document. Each part is shifted by the total
+// duration of the parts before it, so durations needs at least
+// len(parts)-1 items: usually the lengths of the matching video parts.
+func Join(parts []*Document, durations []time.Duration) (*Document, error) {
+	if len(parts) > 0 && len(durations) < len(parts)-1 {
+		return nil, fmt.Errorf("need %d part durations, got %d", len(parts)-1, len(durations))
+	}
+	out := &Document{Format: FormatSRT}
+	var offset time.Duration
+	for i, p := range parts {
+		if i > 0 {
+			offset += durations[i-1]
+		}
+		out.Cues = append(out.Cues, p.Shift(offset).Cues...)
+	}
+	return out, nil
+}
+
+// Split cuts the document at the given times, in ascending order, and
+// returns len(at)+1 parts. Each part is rebased to start at 0, cues go
+// to the part in which they start, and are trimmed at the cut.
+func (d *Document) Split(at []time.Duration) ([]*Document, error) {
+	for i := 1; i < len(at); i++ {
+		if at[i] <= at[i-1] {
+			return nil, fmt.Errorf("split times must be ascending")
+		}
+	}
+
+	parts := make([]*Document, len(at)+1)
+	for i := range parts {
+		parts[i] = &Document{Format: d.Format}
+	}
+	for _, c := range d.Cues {
+		i := sort.Search(len(at), func(i int) bool { return at[i] > c.Start })
+		var start time.Duration
+		if i > 0 {
+			start = at[i-1]
+		}
+		if i < len(at) && c.End > at[i] {
+			c.End = at[i]
+		}
+		c.Start -= start
+		c.End -= start
+		parts[i].Cues = append(parts[i].Cues, c)
+	}
+	return parts, nil
+}
+
+// SplitDurations cuts the document in parts of the given durations,
+// usually the lengths of the video parts. The last part keeps all the
+// remaining cues.
+func (d *Document) SplitDurations(durations []time.Duration) ([]*Document, error) {
+	if len(durations) == 0 {
+		return []*Document{d.Shift(0)}, nil
+	}
+	at := make([]time.Duration, len(durations)-1)
+	var offset time.Duration
+	for i := range at {
+		offset += durations[i]
+		at[i] = offset
+	}
+	return d.Split(at)
+}
@@ -0,0 +1,187 @@
+package osdb
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testSRT = "\uFEFF1\r\n" +
+	"00:00:01,000 --> 00:00:02,500\r\n" +
+	"Hello\r\n" +
+	"world!\r\n" +
+	"\r\n" +
+	"2\r\n" +
+	"01:02:03,004 --> 01:02:05,000 X1:0 X2:1\r\n" +
+	"Bye.\r\n"
+
+func TestParseSRT(t *testing.T) {
+	doc, err := Parse(strings.NewReader(testSRT))
+	if err != nil {
+		t.Fatalf("Expected document, got error: %v", err)
+	}
+	if doc.Format != FormatSRT {
+		t.Fatalf("Expected srt format, got %s", doc.Format)
+	}
+	if len(doc.Cues) != 2 {
+		t.Fatalf("Expected 2 cues, got %d", len(doc.Cues))
+	}
+	c := doc.Cues[0]
+	if c.Start != time.Second || c.End != 2500*time.Millisecond {
+		t.Fatalf("Unexpected timing: %v --> %v", c.Start, c.End)
+	}
+	if c.Text() != "Hello\nworld!" {
+		t.Fatalf("Unexpected text: %q", c.Text())
+	}
+	expected := time.Hour + 2*time.Minute + 3*time.Second + 4*time.Millisecond
+	if doc.Cues[1].Start != expected {
+		t.Fatalf("Expected start %v, got %v", expected, doc.Cues[1].Start)
+	}
+}
+
+func TestParseVTT(t *testing.T) {
+	vtt := "WEBVTT\n\nNOTE some\ncomment\n\nintro\n00:01.500 --> 00:02.000 align:start\nHi\n"
+	doc, err := Parse(strings.NewReader(vtt))
+	if err != nil {
+		t.Fatalf("Expected document, got error: %v", err)
+	}
+	if doc.Format != FormatVTT || len(doc.Cues) != 1 {
+		t.Fatalf("Unexpected document: %+v", doc)
+	}
+	if doc.Cues[0].Start != 1500*time.Millisecond {
+		t.Fatalf("Unexpected start: %v", doc.Cues[0].Start)
+	}
+}
+
+func TestParseMalformed(t *testing.T) {
+	_, err := Parse(strings.NewReader("1\nnot a timing\nHello\n"))
+	perr, ok := err.(*ParseError)
+	if !ok {
+		t.Fatalf("Expected *ParseError, got: %v", err)
+	}
+	if perr.Line != 2 {
+		t.Fatalf("Expected error on line 2, got %d", perr.Line)
+	}
+}
+
+func TestWriteSRT(t *testing.T) {
+	doc, err := Parse(strings.NewReader(testSRT))
+	if err != nil {
+		t.Fatalf("Expected document, got error: %v", err)
+	}
+	out := new(bytes.Buffer)
+	if err := doc.WriteSRT(out); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	expected := "1\n00:00:01,000 --> 00:00:02,500\nHello\nworld!\n\n" +
+		"2\n01:02:03,004 --> 01:02:05,000\nBye.\n"
+	if out.String() != expected {
+		t.Fatalf("Expected %q, got %q", expected, out.String())
+	}
+}
+
+func TestJoin(t *testing.T) {
+	cd1 := &Document{Cues: []Cue{{Start: time.Second, End: 2 * time.Second, Lines: []string{"one"}}}}
+	cd2 := &Document{Cues: []Cue{{Start: time.Second, End: 3 * time.Second, Lines: []string{"two"}}}}
+
+	if _, err := Join([]*Document{cd1, cd2}, nil); err == nil {
+		t.Fatalf("Expected an error without durations")
+	}
+
+	doc, err := Join([]*Document{cd1, cd2}, []time.Duration{time.Hour})
+	if err != nil {
+		t.Fatalf("Expected document, got error: %v", err)
+	}
+	if len(doc.Cues) != 2 {
+		t.Fatalf("Expected 2 cues, got %d", len(doc.Cues))
+	}
+	c := doc.Cues[1]
+	if c.Start != time.Hour+time.Second || c.End != time.Hour+3*time.Second {
+		t.Fatalf("Unexpected timing: %v --> %v", c.Start, c.End)
+	}
+	if cd2.Cues[0].Start != time.Second {
+		t.Fatalf("Expected parts to be left untouched")
+	}
+}
+
+func TestSplit(t *testing.T) {
+	doc := &Document{Cues: []Cue{
+		{Start: time.Second, End: 2 * time.Second, Lines: []string{"one"}},
+		{Start: 9 * time.Second, End: 11 * time.Second, Lines: []string{"two"}},
+		{Start: 12 * time.Second, End: 13 * time.Second, Lines: []string{"three"}},
+	}}
+
+	parts, err := doc.SplitDurations([]time.Duration{10 * time.Second, 10 * time.Second})
+	if err != nil {
+		t.Fatalf("Expected parts, got error: %v", err)
+	}
+	if len(parts) != 2 || len(parts[0].Cues) != 2 || len(parts[1].Cues) != 1 {
+		t.Fatalf("Unexpected parts: %+v", parts)
+	}
+	if parts[0].Cues[1].End != 10*time.Second {
+		t.Fatalf("Expected cue to be trimmed at the cut, got %v", parts[0].Cues[1].End)
+	}
+	if c := parts[1].Cues[0]; c.Start != 2*time.Second || c.End != 3*time.Second {
+		t.Fatalf("Expected rebased cue, got %v --> %v", c.Start, c.End)
+	}
+
+	if _, err := doc.Split([]time.Duration{2 * time.Second, time.Second}); err == nil {
+		t.Fatalf("Expected an error with unordered split times")
+	}
+}
+
+func TestParseTimestamp(t *testing.T) {
+	for s, expected := range map[string]time.Duration{
+		"01:02:03,456": time.Hour + 2*time.Minute + 3*time.Second + 456*time.Millisecond,
+		"02:03.4":      2*time.Minute + 3*time.Second + 400*time.Millisecond,
+		"52:10":        52*time.Minute + 10*time.Second,
+	} {
+		d, err := ParseTimestamp(s)
+		if err != nil || d != expected {
+			t.Fatalf("%s: expected %v, got %v (%v)", s, expected, d, err)
+		}
+	}
+}
+
+func TestParseTimestampErrors(t *testing.T) {
+	for _, s := range []string{
+		"",            // empty
+		"5",           // bare number
+		"5,000",       // bare number, with milliseconds
+		"1:2:3:4",     // too many parts
+		"1:2:3:4,000", // too many parts, with milliseconds
+		"-1:02",       // negative field
+		"01:-02:03",   // negative field
+		"01:02.-5",    // negative milliseconds
+		":02",         // empty field
+		"01::03",      // empty field
+		"01:02:",      // empty field
+		"01:02.",      // empty milliseconds
+		"01:0x:03",    // not a number
+		" 01:02",      // spaces
+	} {
+		if d, err := ParseTimestamp(s); err == nil {
+			t.Errorf("%q: expected an error, got %v", s, d)
+		}
+	}
+}
+
+func TestWriteVTT(t *testing.T) {
+	doc, err := ParseBytes([]byte("WEBVTT\n\n00:01.000 --> 00:02.500\nHello\n\n1\n01:00:03.000 --> 01:00:04.000\nWorld\n"))
+	if err != nil {
+		t.Fatalf("Expected document, got error: %v", err)
+	}
+	buf := new(bytes.Buffer)
+	if err := doc.Write(buf); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	expected := "WEBVTT\n\n00:00:01.000 --> 00:00:02.500\nHello\n\n01:00:03.000 --> 01:00:04.000\nWorld\n"
+	if buf.String() != expected {
+		t.Fatalf("Expected %q, got %q", expected, buf.String())
+	}
+	again, err := ParseBytes(buf.Bytes())
+	if err != nil || again.Format != FormatVTT || len(again.Cues) != 2 {
+		t.Fatalf("Can't parse written WebVTT: %+v, error: %v", again, err)
+	}
+}
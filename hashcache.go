@@ -0,0 +1,157 @@
+package osdb
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// HashCache keeps movie hashes in a file, so that movies are not read
+// again on every run. Entries are keyed by device, inode, size and
+// modification time: renamed files keep their hash, and modified ones
+// are hashed again. Without inodes, e.g. on Windows, entries are keyed
+// by absolute path instead of device and inode. A nil *HashCache hashes
+// files without caching.
+type HashCache struct {
+	path    string
+	mu      sync.Mutex
+	entries map[string]hashEntry
+	dirty   bool
+}
+
+type hashEntry struct {
+	Hash string    `json:"hash"`
+	Path string    `json:"path"` // where the file was last seen
+	Used time.Time `json:"used"`
+}
+
+// OpenHashCache loads a hash cache from path, or starts an empty one
+// when the file does not exist yet. Call Save to write it back.
+func OpenHashCache(path string) (*HashCache, error) {
+	c := &HashCache{path: path, entries: map[string]hashEntry{}}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &c.entries); err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	return c, nil
+}
+
+// HashFile returns the OSDB hash of file, from the cache when possible.
+func (c *HashCache) HashFile(file *os.File) (uint64, error) {
+	if c == nil {
+		return HashFile(file)
+	}
+	fi, err := file.Stat()
+	if err != nil {
+		return 0, err
+	}
+	path, err := filepath.Abs(file.Name())
+	if err != nil {
+		return HashFile(file)
+	}
+	key := hashCacheKey(path, fi)
+
+	c.mu.Lock()
+	e, found := c.entries[key]
+	c.mu.Unlock()
+	if found {
+		if hash, err := strconv.ParseUint(e.Hash, 16, 64); err == nil {
+			c.touch(key, hashEntry{e.Hash, path, time.Now()})
+			return hash, nil
+		}
+	}
+
+	hash, err := HashFile(file)
+	if err != nil {
+		return 0, err
+	}
+	c.touch(key, hashEntry{hashString(hash), path, time.Now()})
+	return hash, nil
+}
+
+// Key of a file in a HashCache, from its absolute path, size and mtime.
+func pathCacheKey(path string, fi os.FileInfo) string {
+	return fmt.Sprintf("path:%s:%d:%d", path, fi.Size(), fi.ModTime().UnixNano())
+}
+
+// Hash returns the OSDB hash of the file at path, from the cache when
+// possible.
+func (c *HashCache) Hash(path string) (uint64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	return c.HashFile(file)
+}
+
+func (c *HashCache) touch(key string, e hashEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key] = e
+	c.dirty = true
+}
+
+// Len returns the number of cached hashes.
+func (c *HashCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
+
+// Prune removes the entries of files that are gone, or changed, since
+// they were last seen, and those unused for more than maxAge, unless
+// maxAge is 0. It returns the number of entries removed.
+func (c *HashCache) Prune(maxAge time.Duration) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	removed := 0
+	for key, e := range c.entries {
+		stale := maxAge > 0 && time.Since(e.Used) > maxAge
+		if !stale {
+			fi, err := os.Stat(e.Path)
+			stale = err != nil || hashCacheKey(e.Path, fi) != key
+		}
+		if stale {
+			delete(c.entries, key)
+			removed++
+		}
+	}
+	if removed > 0 {
+		c.dirty = true
+	}
+	return removed
+}
+
+// Save writes the cache to its file, if it changed. The file is
+// replaced atomically, so that it is never left half-written.
+func (c *HashCache) Save() error {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.dirty {
+		return nil
+	}
+	data, err := json.Marshal(c.entries)
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(c.path, data); err != nil {
+		return err
+	}
+	c.dirty = false
+	return nil
+}
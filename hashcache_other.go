@@ -0,0 +1,12 @@
+//go:build windows || plan9
+// +build windows plan9
+
+package osdb
+
+import "os"
+
+// Files have no inode here: they are keyed by path, size and mtime, so
+// renamed files are hashed again.
+func hashCacheKey(path string, fi os.FileInfo) string {
+	return pathCacheKey(path, fi)
+}
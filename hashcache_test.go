@@ -0,0 +1,125 @@
+package osdb
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestHashCache(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("No inodes on Windows: renamed files are hashed again")
+	}
+	dir, err := ioutil.TempDir("", "osdb")
+	if err != nil {
+		t.Fatalf("Can't create temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	data := make([]byte, ChunkSize*2)
+	copy(data, []byte("blablabla"))
+	movie := filepath.Join(dir, "movie.avi")
+	if err := ioutil.WriteFile(movie, data, 0644); err != nil {
+		t.Fatalf("Can't create sample file: %s", err)
+	}
+
+	cachePath := filepath.Join(dir, "hashes.json")
+	c, err := OpenHashCache(cachePath)
+	if err != nil {
+		t.Fatalf("Can't open cache: %s", err)
+	}
+	hash, err := c.Hash(movie)
+	if err != nil || hash != 0x6c62616c62636cc3 {
+		t.Fatalf("Unexpected hash 0x%016x, error: %v", hash, err)
+	}
+	if c.Len() != 1 {
+		t.Fatalf("Expected 1 entry, got %d", c.Len())
+	}
+
+	// Cached hashes are returned without reading files: fake one to
+	// tell them apart.
+	for key, e := range c.entries {
+		e.Hash = "0000000000000042"
+		c.entries[key] = e
+	}
+	if err := c.Save(); err != nil {
+		t.Fatalf("Can't save cache: %s", err)
+	}
+	c, err = OpenHashCache(cachePath)
+	if err != nil {
+		t.Fatalf("Can't reopen cache: %s", err)
+	}
+
+	renamed := filepath.Join(dir, "renamed.avi")
+	if err := os.Rename(movie, renamed); err != nil {
+		t.Fatalf("Can't rename: %s", err)
+	}
+	if hash, _ := c.Hash(renamed); hash != 0x42 {
+		t.Fatalf("Expected cached hash for renamed file, got 0x%016x", hash)
+	}
+
+	// Modified files are hashed again.
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(renamed, later, later); err != nil {
+		t.Fatalf("Can't touch file: %s", err)
+	}
+	if hash, _ := c.Hash(renamed); hash != 0x6c62616c62636cc3 {
+		t.Fatalf("Expected fresh hash for modified file, got 0x%016x", hash)
+	}
+
+	// The old entry is gone with the previous mtime, then the file.
+	if n := c.Prune(0); n != 1 || c.Len() != 1 {
+		t.Fatalf("Expected 1 pruned entry, got %d, %d left", n, c.Len())
+	}
+	os.Remove(renamed)
+	if n := c.Prune(0); n != 1 || c.Len() != 0 {
+		t.Fatalf("Expected 1 pruned entry, got %d, %d left", n, c.Len())
+	}
+}
+
+// A file without inode, as seen on Windows.
+type pathFileInfo struct {
+	os.FileInfo
+	size    int64
+	modTime time.Time
+}
+
+func (fi pathFileInfo) Size() int64        { return fi.size }
+func (fi pathFileInfo) ModTime() time.Time { return fi.modTime }
+func (fi pathFileInfo) Sys() interface{}   { return nil }
+
+func TestHashCacheKeyWithoutInode(t *testing.T) {
+	now := time.Now()
+	key := hashCacheKey("/movies/movie.avi", pathFileInfo{size: 100, modTime: now})
+	if key == "" {
+		t.Fatalf("Expected a key for a file without inode")
+	}
+	for _, tt := range []struct {
+		name string
+		path string
+		fi   pathFileInfo
+		same bool
+	}{
+		{"same file", "/movies/movie.avi", pathFileInfo{size: 100, modTime: now}, true},
+		{"renamed", "/movies/renamed.avi", pathFileInfo{size: 100, modTime: now}, false},
+		{"resized", "/movies/movie.avi", pathFileInfo{size: 101, modTime: now}, false},
+		{"modified", "/movies/movie.avi", pathFileInfo{size: 100, modTime: now.Add(time.Second)}, false},
+	} {
+		if same := hashCacheKey(tt.path, tt.fi) == key; same != tt.same {
+			t.Errorf("%s: expected same key %v, got %v", tt.name, tt.same, same)
+		}
+	}
+}
+
+func TestNilHashCache(t *testing.T) {
+	var c *HashCache
+	if _, err := c.Hash("./nonexistent"); err == nil {
+		t.Fatalf("Expected an error, got none")
+	}
+	if err := c.Save(); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+}
@@ -0,0 +1,20 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package osdb
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// Key of a file in a HashCache: device, inode, size and mtime, or its
+// path when there is no inode.
+func hashCacheKey(path string, fi os.FileInfo) string {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return pathCacheKey(path, fi)
+	}
+	return fmt.Sprintf("%x:%x:%d:%d", uint64(st.Dev), uint64(st.Ino), fi.Size(), fi.ModTime().UnixNano())
+}
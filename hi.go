@@ -0,0 +1,168 @@
+package osdb
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// HearingImpairedThreshold is the share of cues carrying hearing-impaired
+// annotations above which DetectHearingImpaired classifies a document as
+// HI.
+const HearingImpairedThreshold = 0.05
+
+var (
+	// Sound descriptions: [door slams], (MUSIC), etc. Parentheses are
+	// also used in dialog, see isSoundCue.
+	hiSoundRe = regexp.MustCompile(`\[[^\]]*\]|\([^)]*\)`)
+	// Sound descriptions spanning a line break: brackets, or parentheses
+	// in capitals.
+	hiOpenRe  = regexp.MustCompile(`\[[^\]]*$|\([^)\p{Ll}]*$`)
+	hiCloseRe = regexp.MustCompile(`^[^\[(]*[\])]`)
+	// Speaker labels: "JOHN:", "- MAN #2:", etc.
+	hiSpeakerRe = regexp.MustCompile(`^(\s*(?:<[^>]+>)*\s*-?\s*)\p{Lu}[\p{Lu}\d .'#&-]*[\p{Lu}\d]:(\s+|$)`)
+	// Song lyrics.
+	hiLyricsRe = regexp.MustCompile(`[♪♫]`)
+	// Tags left empty after stripping, e.g. "<i></i>".
+	emptyTagRe = regexp.MustCompile(`<(\w+)[^>]*>[\s-]*</(\w+)>`)
+	// Spaces left before punctuation.
+	spacePunctRe = regexp.MustCompile(`\s+([.,!?;:])(\s|$)`)
+	// Lines with only dialog dashes, punctuation, or tags.
+	blankLineRe = regexp.MustCompile(`^(\s|-|:|<[^>]*>)*$`)
+)
+
+// Words starting sound descriptions in lower case parentheses, e.g.
+// "(laughs)", "(door closes)".
+var hiSoundWords = map[string]bool{
+	"applause": true, "beeping": true, "bell": true, "chuckles": true,
+	"chuckling": true, "clears": true, "coughs": true, "coughing": true,
+	"cries": true, "crying": true, "door": true, "exhales": true,
+	"gasps": true, "gasping": true, "groans": true, "grunts": true,
+	"inhales": true, "knocking": true, "laughs": true, "laughing": true,
+	"laughter": true, "music": true, "panting": true, "phone": true,
+	"screams": true, "screaming": true, "sighs": true, "sniffles": true,
+	"sobbing": true, "sobs": true, "thunder": true, "whispers": true,
+	"whispering": true, "yells": true,
+}
+
+// Tell whether a "[...]" or "(...)" match is a sound description: all
+// brackets are, while parentheses must be in capitals, or start with a
+// sound word. Parenthesized dialog, e.g. "(with a remark)", is not.
+func isSoundCue(m string) bool {
+	if strings.HasPrefix(m, "[") {
+		return true
+	}
+	inner := strings.Trim(m, "()")
+	if strings.IndexFunc(inner, isLetter) < 0 {
+		return false
+	}
+	if strings.IndexFunc(inner, unicode.IsLower) < 0 {
+		return true
+	}
+	words := strings.Fields(strings.ToLower(inner))
+	return len(words) > 0 && hiSoundWords[strings.Trim(words[0], ".,!?")]
+}
+
+func stripSoundCue(m string) string {
+	if isSoundCue(m) {
+		return ""
+	}
+	return m
+}
+
+// StripHearingImpaired returns a copy of the document without sound
+// descriptions, song lyrics and speaker labels. Cues left empty are
+// removed.
+func (d *Document) StripHearingImpaired() *Document {
+	out := &Document{Format: d.Format}
+	for _, c := range d.Cues {
+		lines := stripHearingImpaired(c.Lines)
+		if len(lines) == 0 {
+			continue
+		}
+		c.Lines = lines
+		out.Cues = append(out.Cues, c)
+	}
+	return out
+}
+
+func stripHearingImpaired(lines []string) []string {
+	var (
+		out    []string
+		inside bool // in a multi-line sound description
+	)
+	for _, line := range lines {
+		if inside {
+			loc := hiCloseRe.FindStringIndex(line)
+			if loc == nil {
+				continue
+			}
+			line = line[loc[1]:]
+			inside = false
+		}
+		if hiLyricsRe.MatchString(line) {
+			continue
+		}
+		line = hiSoundRe.ReplaceAllStringFunc(line, stripSoundCue)
+		if loc := hiOpenRe.FindStringIndex(line); loc != nil {
+			line = line[:loc[0]]
+			inside = true
+		}
+		line = hiSpeakerRe.ReplaceAllString(line, "$1")
+		line = emptyTagRe.ReplaceAllString(line, "")
+		line = strings.Join(strings.Fields(line), " ")
+		line = spacePunctRe.ReplaceAllString(line, "$1$2")
+		if blankLineRe.MatchString(line) {
+			continue
+		}
+		out = append(out, line)
+	}
+
+	// A single remaining line of a dialog loses its dash.
+	if len(out) == 1 {
+		out[0] = strings.TrimSpace(strings.TrimPrefix(out[0], "-"))
+	}
+	return out
+}
+
+// HasHearingImpaired tells whether a cue carries hearing-impaired
+// annotations.
+func (c Cue) HasHearingImpaired() bool {
+	for _, line := range c.Lines {
+		if hiLyricsRe.MatchString(line) || hiSpeakerRe.MatchString(line) {
+			return true
+		}
+		for _, m := range hiSoundRe.FindAllString(line, -1) {
+			// Ignore "(...)" or "[ ]" which are not descriptions.
+			if isSoundCue(m) && strings.IndexFunc(m, isLetter) >= 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// HearingImpairedRatio returns the share of cues carrying
+// hearing-impaired annotations, between 0 and 1.
+func (d *Document) HearingImpairedRatio() float64 {
+	if len(d.Cues) == 0 {
+		return 0
+	}
+	n := 0
+	for _, c := range d.Cues {
+		if c.HasHearingImpaired() {
+			n++
+		}
+	}
+	return float64(n) / float64(len(d.Cues))
+}
+
+// DetectHearingImpaired classifies a document as hearing-impaired from
+// its contents, regardless of what OSDB claims in SubHearingImpaired.
+func DetectHearingImpaired(d *Document) bool {
+	return d.HearingImpairedRatio() >= HearingImpairedThreshold
+}
+
+func isLetter(r rune) bool {
+	return ('a' <= r && r <= 'z') || ('A' <= r && r <= 'Z') || r > 0x7f
+}
@@ -0,0 +1,91 @@
+package osdb
+
+import (
+	"strings"
+	"testing"
+)
+
+const testHISRT = `1
+00:00:01,000 --> 00:00:02,000
+[door slams]
+
+2
+00:00:03,000 --> 00:00:04,000
+JOHN: Who's there?
+
+3
+00:00:05,000 --> 00:00:06,000
+- (GASPS) It's me.
+- MARY #2: You?
+
+4
+00:00:07,000 --> 00:00:08,000
+♪ Happy birthday to you ♪
+
+5
+00:00:09,000 --> 00:00:10,000
+<i>[thunder rumbling</i>
+<i>in the distance]</i>
+Nice weather.
+
+6
+00:00:11,000 --> 00:00:12,000
+Plain dialog (with a remark).
+
+7
+00:00:13,000 --> 00:00:14,000
+(laughs) Good one.
+`
+
+func TestStripHearingImpaired(t *testing.T) {
+	doc, err := Parse(strings.NewReader(testHISRT))
+	if err != nil {
+		t.Fatalf("Expected document, got error: %v", err)
+	}
+	clean := doc.StripHearingImpaired()
+
+	expected := []string{
+		"Who's there?",
+		"- It's me.\n- You?",
+		"Nice weather.",
+		"Plain dialog (with a remark).",
+		"Good one.",
+	}
+	if len(clean.Cues) != len(expected) {
+		t.Fatalf("Expected %d cues, got %d: %+v", len(expected), len(clean.Cues), clean.Cues)
+	}
+	for i, text := range expected {
+		if clean.Cues[i].Text() != text {
+			t.Fatalf("Cue %d: expected %q, got %q", i+1, text, clean.Cues[i].Text())
+		}
+	}
+	if len(doc.Cues) != 7 {
+		t.Fatalf("Expected original document to be left untouched")
+	}
+}
+
+func TestDetectHearingImpaired(t *testing.T) {
+	doc, err := Parse(strings.NewReader(testHISRT))
+	if err != nil {
+		t.Fatalf("Expected document, got error: %v", err)
+	}
+	if !DetectHearingImpaired(doc) {
+		t.Fatalf("Expected HI document, ratio: %f", doc.HearingImpairedRatio())
+	}
+	if DetectHearingImpaired(doc.StripHearingImpaired()) {
+		t.Fatalf("Expected stripped document not to be HI")
+	}
+}
+
+func TestDetectHearingImpairedDialog(t *testing.T) {
+	doc := &Document{}
+	for i := 0; i < 10; i++ {
+		doc.Cues = append(doc.Cues, Cue{Lines: []string{"I told you (again) to wait."}})
+	}
+	if doc.HearingImpairedRatio() != 0 {
+		t.Fatalf("Expected parenthesized dialog not to be HI, ratio: %f", doc.HearingImpairedRatio())
+	}
+	if clean := doc.StripHearingImpaired(); clean.Cues[0].Text() != "I told you (again) to wait." {
+		t.Fatalf("Expected dialog to be kept, got %q", clean.Cues[0].Text())
+	}
+}
@@ -0,0 +1,300 @@
+package osdb
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/charmap"
+)
+
+// Severity of a lint Diagnostic.
+type Severity int
+
+// Diagnostic severities, from least to most severe.
+const (
+	SeverityInfo Severity = iota
+	SeverityWarning
+	SeverityError
+)
+
+var severityNames = []string{"info", "warning", "error"}
+
+func (s Severity) String() string {
+	if s < 0 || int(s) >= len(severityNames) {
+		return fmt.Sprintf("severity(%d)", int(s))
+	}
+	return severityNames[s]
+}
+
+// MarshalText encodes a severity with its name, e.g. in JSON.
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// Diagnostic codes reported by Lint.
+const (
+	LintNegativeDuration = "negative-duration"
+	LintEmptyCue         = "empty-cue"
+	LintUnordered        = "unordered"
+	LintOverlap          = "overlap"
+	LintPastMovieEnd     = "past-movie-end"
+	LintLineLength       = "line-length"
+	LintReadingSpeed     = "reading-speed"
+	LintUnbalancedTags   = "unbalanced-tags"
+	LintEncoding         = "encoding-artifact"
+)
+
+// Diagnostic is a problem found in a subtitle document.
+type Diagnostic struct {
+	Severity Severity `json:"severity"`
+	Code     string   `json:"code"`
+	Cue      int      `json:"cue"`            // 1-based cue number
+	Line     int      `json:"line,omitempty"` // 1-based line in the cue
+	Message  string   `json:"message"`
+	Fixable  bool     `json:"fixable"`
+}
+
+func (d Diagnostic) String() string {
+	loc := fmt.Sprintf("cue %d", d.Cue)
+	if d.Line > 0 {
+		loc += fmt.Sprintf(", line %d", d.Line)
+	}
+	return fmt.Sprintf("%s: %s: %s [%s]", loc, d.Severity, d.Message, d.Code)
+}
+
+// Default LintOptions values.
+const (
+	DefaultMaxLineLength = 40
+	DefaultMaxCPS        = 25
+)
+
+// LintOptions tune the checks done by Lint. Zero values use defaults.
+type LintOptions struct {
+	// MovieDuration is the length of the movie, when known, e.g. from
+	// Subtitle.MovieTimeMS.
+	MovieDuration time.Duration
+	// MaxLineLength in characters, tags excluded.
+	MaxLineLength int
+	// MaxCPS is the maximum reading speed, in characters per second.
+	MaxCPS float64
+}
+
+func (o LintOptions) withDefaults() LintOptions {
+	if o.MaxLineLength <= 0 {
+		o.MaxLineLength = DefaultMaxLineLength
+	}
+	if o.MaxCPS <= 0 {
+		o.MaxCPS = DefaultMaxCPS
+	}
+	return o
+}
+
+var (
+	tagRe = regexp.MustCompile(`</?([a-zA-Z]+)[^>]*>|\{\\[^}]*\}`)
+	// UTF-8 text decoded as Windows-1252, e.g. "Ã©" for "é".
+	mojibakeRe = regexp.MustCompile(`[ÃÂâ][\x{80}-\x{BF}\x{152}\x{153}\x{160}\x{161}\x{178}\x{17D}\x{17E}\x{192}\x{2C6}\x{2DC}\x{2013}-\x{203A}\x{20AC}\x{2122}]`)
+)
+
+// Lint checks a subtitle document for common problems, and returns
+// diagnostics in cue order.
+func (d *Document) Lint(opts LintOptions) []Diagnostic {
+	opts = opts.withDefaults()
+	var diags []Diagnostic
+	report := func(sev Severity, code string, cue, line int, fixable bool, format string, args ...interface{}) {
+		diags = append(diags, Diagnostic{
+			Severity: sev,
+			Code:     code,
+			Cue:      cue + 1,
+			Line:     line,
+			Message:  fmt.Sprintf(format, args...),
+			Fixable:  fixable,
+		})
+	}
+
+	for i, c := range d.Cues {
+		if c.End < c.Start {
+			report(SeverityError, LintNegativeDuration, i, 0, true,
+				"ends before it starts (%s --> %s)", formatTimestamp(c.Start), formatTimestamp(c.End))
+		}
+		if strings.TrimSpace(stripTags(c.Text())) == "" {
+			report(SeverityWarning, LintEmptyCue, i, 0, true, "has no text")
+		}
+		if i > 0 {
+			prev := d.Cues[i-1]
+			if c.Start < prev.Start {
+				report(SeverityError, LintUnordered, i, 0, true,
+					"starts before cue %d (%s < %s)", i, formatTimestamp(c.Start), formatTimestamp(prev.Start))
+			} else if c.Start < prev.End {
+				report(SeverityWarning, LintOverlap, i, 0, true,
+					"overlaps cue %d by %s", i, prev.End-c.Start)
+			}
+		}
+		if opts.MovieDuration > 0 {
+			if c.Start >= opts.MovieDuration {
+				report(SeverityError, LintPastMovieEnd, i, 0, false,
+					"starts after the end of the movie (%s)", formatTimestamp(opts.MovieDuration))
+			} else if c.End > opts.MovieDuration {
+				report(SeverityWarning, LintPastMovieEnd, i, 0, true,
+					"ends after the end of the movie (%s)", formatTimestamp(opts.MovieDuration))
+			}
+		}
+
+		chars := 0
+		for j, line := range c.Lines {
+			n := utf8.RuneCountInString(stripTags(line))
+			chars += n
+			if n > opts.MaxLineLength {
+				report(SeverityWarning, LintLineLength, i, j+1, false,
+					"line has %d characters, over %d", n, opts.MaxLineLength)
+			}
+			if strings.ContainsRune(line, utf8.RuneError) {
+				report(SeverityError, LintEncoding, i, j+1, false,
+					"contains replacement characters (U+FFFD)")
+			} else if mojibakeRe.MatchString(line) {
+				report(SeverityWarning, LintEncoding, i, j+1, fixMojibake(line) != line,
+					"looks like mis-decoded UTF-8")
+			}
+		}
+		if dur := c.Duration(); dur > 0 && chars > 0 {
+			cps := float64(chars) / dur.Seconds()
+			if cps > opts.MaxCPS {
+				report(SeverityWarning, LintReadingSpeed, i, 0, false,
+					"reading speed is %.1f characters/s, over %g", cps, opts.MaxCPS)
+			}
+		}
+		if _, ok := balanceTags(c.Lines); !ok {
+			report(SeverityWarning, LintUnbalancedTags, i, 0, true, "has unbalanced tags")
+		}
+	}
+
+	return diags
+}
+
+// Fix returns a copy of the document with mechanical problems fixed:
+// swapped timings, empty cues, cue order, overlaps, cues ending after
+// the movie, unbalanced tags and mis-decoded UTF-8. Overlapping cues are
+// cut, or merged when they start at the same time. It also returns the
+// diagnostics that were fixed.
+func (d *Document) Fix(opts LintOptions) (*Document, []Diagnostic) {
+	var fixed []Diagnostic
+	for _, diag := range d.Lint(opts) {
+		if diag.Fixable {
+			fixed = append(fixed, diag)
+		}
+	}
+
+	out := &Document{Format: d.Format}
+	for _, c := range d.Cues {
+		if strings.TrimSpace(stripTags(c.Text())) == "" {
+			continue
+		}
+		if c.End < c.Start {
+			c.Start, c.End = c.End, c.Start
+		}
+		if opts.MovieDuration > 0 && c.Start < opts.MovieDuration && c.End > opts.MovieDuration {
+			c.End = opts.MovieDuration
+		}
+		lines := make([]string, len(c.Lines))
+		for j, line := range c.Lines {
+			lines[j] = fixMojibake(line)
+		}
+		c.Lines, _ = balanceTags(lines)
+		out.Cues = append(out.Cues, c)
+	}
+
+	sort.SliceStable(out.Cues, func(i, j int) bool {
+		return out.Cues[i].Start < out.Cues[j].Start
+	})
+	// Cues starting at the same time can't be cut to end before the
+	// other one: merge them.
+	merged := []Cue{}
+	for _, c := range out.Cues {
+		if n := len(merged); n > 0 && c.Start == merged[n-1].Start {
+			prev := &merged[n-1]
+			prev.Lines = append(append([]string{}, prev.Lines...), c.Lines...)
+			if c.End > prev.End {
+				prev.End = c.End
+			}
+			continue
+		}
+		merged = append(merged, c)
+	}
+	out.Cues = merged
+	for i := 1; i < len(out.Cues); i++ {
+		prev := &out.Cues[i-1]
+		if start := out.Cues[i].Start; start < prev.End && start > prev.Start {
+			prev.End = start
+		}
+	}
+
+	return out, fixed
+}
+
+func stripTags(s string) string {
+	return tagRe.ReplaceAllString(s, "")
+}
+
+// HTML tags without closing tags.
+var voidTags = map[string]bool{"br": true, "hr": true, "img": true, "wbr": true}
+
+// Check HTML-like tags of a cue, and return its lines with missing
+// closing tags added, and stray closing tags removed.
+func balanceTags(lines []string) ([]string, bool) {
+	var (
+		open []string
+		ok   = true
+		out  = make([]string, len(lines))
+	)
+	for i, line := range lines {
+		out[i] = tagRe.ReplaceAllStringFunc(line, func(tag string) string {
+			if strings.HasPrefix(tag, "{") {
+				return tag // ASS override, e.g. {\an8}
+			}
+			name := strings.ToLower(tagRe.FindStringSubmatch(tag)[1])
+			if voidTags[name] || strings.HasSuffix(tag, "/>") {
+				return tag // never closed, e.g. <br> or <br/>
+			}
+			if !strings.HasPrefix(tag, "</") {
+				open = append(open, name)
+				return tag
+			}
+			for j := len(open) - 1; j >= 0; j-- {
+				if open[j] == name {
+					// Close what was left open inside this tag.
+					closing := ""
+					for k := len(open) - 1; k > j; k-- {
+						closing += "</" + open[k] + ">"
+						ok = false
+					}
+					open = open[:j]
+					return closing + tag
+				}
+			}
+			ok = false
+			return ""
+		})
+	}
+	if len(open) > 0 && len(out) > 0 {
+		ok = false
+		for j := len(open) - 1; j >= 0; j-- {
+			out[len(out)-1] += "</" + open[j] + ">"
+		}
+	}
+	return out, ok
+}
+
+// Repair UTF-8 text that was decoded as Windows-1252.
+func fixMojibake(s string) string {
+	if !mojibakeRe.MatchString(s) {
+		return s
+	}
+	raw, err := charmap.Windows1252.NewEncoder().String(s)
+	if err != nil || !utf8.ValidString(raw) {
+		return s
+	}
+	return raw
+}
@@ -0,0 +1,140 @@
+package osdb
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+const testLintSRT = `1
+00:00:01,000 --> 00:00:03,000
+<i>Hello
+
+2
+00:00:02,500 --> 00:00:04,000
+This line is definitely longer than forty characters.
+
+3
+00:00:06,000 --> 00:00:05,000
+CafÃ© au lait.
+
+4
+00:00:07,000 --> 00:00:07,200
+Way too fast to read, really.
+
+5
+00:00:08,000 --> 00:00:09,000
+<b></b>
+
+6
+00:00:09,500 --> 00:00:12,000
+The end.
+`
+
+func lintCodes(diags []Diagnostic) map[string]int {
+	codes := map[string]int{}
+	for _, d := range diags {
+		codes[d.Code] = d.Cue
+	}
+	return codes
+}
+
+func TestLint(t *testing.T) {
+	doc, err := Parse(strings.NewReader(testLintSRT))
+	if err != nil {
+		t.Fatalf("Expected document, got error: %v", err)
+	}
+	diags := doc.Lint(LintOptions{MovieDuration: 10 * time.Second})
+
+	expected := map[string]int{
+		LintUnbalancedTags:   1,
+		LintOverlap:          2,
+		LintLineLength:       2,
+		LintNegativeDuration: 3,
+		LintEncoding:         3,
+		LintReadingSpeed:     4,
+		LintEmptyCue:         5,
+		LintPastMovieEnd:     6,
+	}
+	codes := lintCodes(diags)
+	for code, cue := range expected {
+		if codes[code] != cue {
+			t.Errorf("Expected %s on cue %d, got %d", code, cue, codes[code])
+		}
+	}
+	if len(codes) != len(expected) {
+		t.Errorf("Unexpected diagnostics: %v", diags)
+	}
+}
+
+func TestFix(t *testing.T) {
+	doc, err := Parse(strings.NewReader(testLintSRT))
+	if err != nil {
+		t.Fatalf("Expected document, got error: %v", err)
+	}
+	opts := LintOptions{MovieDuration: 10 * time.Second}
+	fixed, diags := doc.Fix(opts)
+	if len(diags) == 0 {
+		t.Fatalf("Expected fixed diagnostics")
+	}
+
+	remaining := lintCodes(fixed.Lint(opts))
+	for code := range remaining {
+		if code != LintLineLength && code != LintReadingSpeed {
+			t.Errorf("Expected %s to be fixed", code)
+		}
+	}
+	if len(fixed.Cues) != 5 {
+		t.Fatalf("Expected empty cue to be removed, got %d cues", len(fixed.Cues))
+	}
+	if fixed.Cues[0].Text() != "<i>Hello</i>" {
+		t.Errorf("Expected balanced tags, got %q", fixed.Cues[0].Text())
+	}
+	if fixed.Cues[0].End != 2500*time.Millisecond {
+		t.Errorf("Expected overlap to be trimmed, got %v", fixed.Cues[0].End)
+	}
+	if c := fixed.Cues[2]; c.Text() != "Café au lait." || c.Start != 5*time.Second {
+		t.Errorf("Unexpected cue: %+v", c)
+	}
+	if fixed.Cues[4].End != 10*time.Second {
+		t.Errorf("Expected last cue to end with the movie, got %v", fixed.Cues[4].End)
+	}
+}
+
+func TestFixSameStart(t *testing.T) {
+	doc := &Document{Cues: []Cue{
+		{Start: time.Second, End: 3 * time.Second, Lines: []string{"- Hello."}},
+		{Start: time.Second, End: 2 * time.Second, Lines: []string{"- Hi."}},
+		{Start: 2500 * time.Millisecond, End: 4 * time.Second, Lines: []string{"Bye."}},
+	}}
+	if codes := lintCodes(doc.Lint(LintOptions{})); codes[LintOverlap] == 0 {
+		t.Fatalf("Expected an overlap, got %v", codes)
+	}
+	fixed, _ := doc.Fix(LintOptions{})
+	if codes := lintCodes(fixed.Lint(LintOptions{})); codes[LintOverlap] > 0 {
+		t.Fatalf("Expected overlaps to be fixed, got %+v", fixed.Cues)
+	}
+	if len(fixed.Cues) != 2 || fixed.Cues[0].Text() != "- Hello.\n- Hi." {
+		t.Fatalf("Expected cues starting together to be merged, got %+v", fixed.Cues)
+	}
+	if fixed.Cues[0].End != 2500*time.Millisecond {
+		t.Fatalf("Expected merged cue to be trimmed, got %v", fixed.Cues[0].End)
+	}
+}
+
+func TestBalanceTags(t *testing.T) {
+	lines, ok := balanceTags([]string{"<i>one <b>two</i>", "three</u>{\\an8}"})
+	if ok {
+		t.Fatalf("Expected unbalanced tags")
+	}
+	if strings.Join(lines, "|") != "<i>one <b>two</b></i>|three{\\an8}" {
+		t.Fatalf("Unexpected result: %q", lines)
+	}
+
+	for _, line := range []string{"<i>Hello<br>world</i>", "<i>Hello<br/>world</i>", "<i>Hello<BR />world</i>"} {
+		lines, ok := balanceTags([]string{line})
+		if !ok || lines[0] != line {
+			t.Fatalf("Expected %q to be balanced, got %q", line, lines[0])
+		}
+	}
+}
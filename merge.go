@@ -0,0 +1,191 @@
+package osdb
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// MergeMinOverlap is the share of the shorter cue that must overlap with
+// a cue of the other language for both to be shown together.
+const MergeMinOverlap = 0.5
+
+// BilingualCue holds text in two languages, shown at the same time.
+// Either side can be empty when a cue had no counterpart.
+type BilingualCue struct {
+	Start  time.Duration
+	End    time.Duration
+	Top    []string
+	Bottom []string
+}
+
+// Bilingual is a subtitle shown in two languages at once.
+type Bilingual struct {
+	Cues []BilingualCue
+}
+
+// Merge pairs the overlapping cues of two subtitle documents, e.g. the
+// same movie in two languages. Cues of the top document are displayed
+// above those of the bottom one.
+func Merge(top, bottom *Document) *Bilingual {
+	n := len(top.Cues)
+	cues := make([]Cue, 0, n+len(bottom.Cues))
+	cues = append(cues, top.Cues...)
+	cues = append(cues, bottom.Cues...)
+
+	// Union-find over all cues, grouping those overlapping enough.
+	parent := make([]int, len(cues))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+	for i := 0; i < n; i++ {
+		for j := n; j < len(cues); j++ {
+			if overlapsEnough(cues[i], cues[j]) {
+				parent[find(j)] = find(i)
+			}
+		}
+	}
+
+	groups := map[int]*BilingualCue{}
+	order := []int{}
+	for i, c := range cues {
+		root := find(i)
+		g, ok := groups[root]
+		if !ok {
+			g = &BilingualCue{Start: c.Start, End: c.End}
+			groups[root] = g
+			order = append(order, root)
+		}
+		if c.Start < g.Start {
+			g.Start = c.Start
+		}
+		if c.End > g.End {
+			g.End = c.End
+		}
+		if i < n {
+			g.Top = append(g.Top, c.Lines...)
+		} else {
+			g.Bottom = append(g.Bottom, c.Lines...)
+		}
+	}
+
+	b := &Bilingual{Cues: make([]BilingualCue, 0, len(order))}
+	for _, root := range order {
+		b.Cues = append(b.Cues, *groups[root])
+	}
+	sort.SliceStable(b.Cues, func(i, j int) bool {
+		return b.Cues[i].Start < b.Cues[j].Start
+	})
+	return b
+}
+
+func overlapsEnough(a, b Cue) bool {
+	start, end := a.Start, a.End
+	if b.Start > start {
+		start = b.Start
+	}
+	if b.End < end {
+		end = b.End
+	}
+	if end <= start {
+		return false
+	}
+	shorter := a.Duration()
+	if d := b.Duration(); d < shorter {
+		shorter = d
+	}
+	return shorter <= 0 || float64(end-start) >= MergeMinOverlap*float64(shorter)
+}
+
+// Document returns the bilingual subtitle as a single document, with
+// the top lines stacked above the bottom ones in each cue.
+func (b *Bilingual) Document() *Document {
+	doc := &Document{Format: FormatSRT, Cues: make([]Cue, len(b.Cues))}
+	for i, c := range b.Cues {
+		lines := make([]string, 0, len(c.Top)+len(c.Bottom))
+		lines = append(lines, c.Top...)
+		lines = append(lines, c.Bottom...)
+		doc.Cues[i] = Cue{Start: c.Start, End: c.End, Lines: lines}
+	}
+	return doc
+}
+
+// WriteSRT writes the bilingual subtitle as a stacked SubRip file.
+func (b *Bilingual) WriteSRT(w io.Writer) error {
+	return b.Document().WriteSRT(w)
+}
+
+const assHeader = `[Script Info]
+ScriptType: v4.00+
+WrapStyle: 0
+ScaledBorderAndShadow: yes
+PlayResX: 1920
+PlayResY: 1080
+
+[V4+ Styles]
+Format: Name, Fontname, Fontsize, PrimaryColour, SecondaryColour, OutlineColour, BackColour, Bold, Italic, Underline, StrikeOut, ScaleX, ScaleY, Spacing, Angle, BorderStyle, Outline, Shadow, Alignment, MarginL, MarginR, MarginV, Encoding
+Style: Top,Arial,56,&H00FFFFFF,&H000000FF,&H00000000,&H80000000,0,0,0,0,100,100,0,0,1,3,1,8,40,40,40,1
+Style: Bottom,Arial,56,&H0000FFFF,&H000000FF,&H00000000,&H80000000,0,0,0,0,100,100,0,0,1,3,1,2,40,40,40,1
+
+[Events]
+Format: Layer, Start, End, Style, Name, MarginL, MarginR, MarginV, Effect, Text
+`
+
+// WriteASS writes the bilingual subtitle as an Advanced SubStation Alpha
+// file, with the top language at the top of the screen, and the bottom
+// language at the bottom.
+func (b *Bilingual) WriteASS(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString(assHeader)
+	for _, c := range b.Cues {
+		for _, side := range []struct {
+			style string
+			lines []string
+		}{{"Top", c.Top}, {"Bottom", c.Bottom}} {
+			if len(side.lines) == 0 {
+				continue
+			}
+			fmt.Fprintf(bw, "Dialogue: 0,%s,%s,%s,,0,0,0,,%s\n",
+				assTimestamp(c.Start), assTimestamp(c.End), side.style, assText(side.lines))
+		}
+	}
+	return bw.Flush()
+}
+
+// Format a timestamp for ASS files, e.g. "1:02:03.45".
+func assTimestamp(d time.Duration) string {
+	if d < 0 {
+		d = 0
+	}
+	cs := d / (10 * time.Millisecond)
+	return fmt.Sprintf("%d:%02d:%02d.%02d", cs/360000, cs/6000%60, cs/100%60, cs%100)
+}
+
+var assTagRe = regexp.MustCompile(`(?i)</?([ibu])>|<[^>]*>`)
+
+// Convert SRT cue lines to ASS dialogue text.
+func assText(lines []string) string {
+	text := strings.Join(lines, `\N`)
+	return assTagRe.ReplaceAllStringFunc(text, func(tag string) string {
+		m := assTagRe.FindStringSubmatch(tag)
+		name := strings.ToLower(m[1])
+		if name == "" {
+			return ""
+		}
+		if strings.HasPrefix(tag, "</") {
+			return `{\` + name + `0}`
+		}
+		return `{\` + name + `1}`
+	})
+}
@@ -0,0 +1,94 @@
+package osdb
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	testMergeEng = `1
+00:00:01,000 --> 00:00:03,000
+<i>Hello!</i>
+
+2
+00:00:04,000 --> 00:00:06,000
+How are you?
+
+3
+00:00:10,000 --> 00:00:11,000
+Bye.
+`
+	testMergeFra = `1
+00:00:01,200 --> 00:00:03,100
+<i>Bonjour !</i>
+
+2
+00:00:04,100 --> 00:00:05,000
+Comment
+
+3
+00:00:05,000 --> 00:00:06,200
+allez-vous ?
+
+4
+00:00:07,000 --> 00:00:08,000
+Hmm.
+`
+)
+
+func testBilingual(t *testing.T) *Bilingual {
+	eng, err := Parse(strings.NewReader(testMergeEng))
+	if err != nil {
+		t.Fatalf("Expected document, got error: %v", err)
+	}
+	fra, err := Parse(strings.NewReader(testMergeFra))
+	if err != nil {
+		t.Fatalf("Expected document, got error: %v", err)
+	}
+	return Merge(eng, fra)
+}
+
+func TestMerge(t *testing.T) {
+	b := testBilingual(t)
+	if len(b.Cues) != 4 {
+		t.Fatalf("Expected 4 cues, got %d: %+v", len(b.Cues), b.Cues)
+	}
+	c := b.Cues[1]
+	if c.Start != 4*time.Second || c.End != 6200*time.Millisecond {
+		t.Fatalf("Unexpected timing: %v --> %v", c.Start, c.End)
+	}
+	if strings.Join(c.Top, "|") != "How are you?" || strings.Join(c.Bottom, "|") != "Comment|allez-vous ?" {
+		t.Fatalf("Unexpected pairing: %+v", c)
+	}
+	if len(b.Cues[2].Top) != 0 || len(b.Cues[3].Bottom) != 0 {
+		t.Fatalf("Expected unpaired cues: %+v", b.Cues[2:])
+	}
+}
+
+func TestBilingualWriteSRT(t *testing.T) {
+	out := new(bytes.Buffer)
+	if err := testBilingual(t).WriteSRT(out); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	expected := "1\n00:00:01,000 --> 00:00:03,100\n<i>Hello!</i>\n<i>Bonjour !</i>\n"
+	if !strings.HasPrefix(out.String(), expected) {
+		t.Fatalf("Expected %q prefix, got %q", expected, out.String())
+	}
+}
+
+func TestBilingualWriteASS(t *testing.T) {
+	out := new(bytes.Buffer)
+	if err := testBilingual(t).WriteASS(out); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	for _, line := range []string{
+		"Dialogue: 0,0:00:01.00,0:00:03.10,Top,,0,0,0,,{\\i1}Hello!{\\i0}\n",
+		"Dialogue: 0,0:00:04.00,0:00:06.20,Bottom,,0,0,0,,Comment\\Nallez-vous ?\n",
+	} {
+		if !strings.Contains(out.String(), line) {
+			t.Fatalf("Expected %q in output:\n%s", line, out.String())
+		}
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"bytes"
 	"encoding/binary"
 	"fmt"
+	"io"
 	"os"
 
 	"github.com/kolo/xmlrpc"
@@ -32,8 +33,11 @@ func NewClient() (*Client, error) {
 	}
 
 	c := &Client{
-		UserAgent: DefaultUserAgent,
-		Client:    rpc, // xmlrpc.Client
+		UserAgent:  DefaultUserAgent,
+		RateLimit:  DefaultRateLimit,
+		RatePeriod: DefaultRatePeriod,
+		limiter:    newRateLimiter(),
+		Client:     rpc, // xmlrpc.Client
 	}
 
 	return c, nil
@@ -45,17 +49,24 @@ func HashFile(file *os.File) (hash uint64, err error) {
 	if err != nil {
 		return
 	}
-	if fi.Size() < ChunkSize {
+	return HashReaderAt(file, fi.Size())
+}
+
+// HashReaderAt generates an OSDB hash for size bytes of content read
+// from r, such as a remote object, or a file inside an archive. Only
+// the first and last ChunkSize bytes are read.
+func HashReaderAt(r io.ReaderAt, size int64) (hash uint64, err error) {
+	if size < ChunkSize {
 		return 0, fmt.Errorf("File is too small")
 	}
 
 	// Read head and tail blocks.
 	buf := make([]byte, ChunkSize*2)
-	err = readChunk(file, 0, buf[:ChunkSize])
+	err = readChunk(r, 0, buf[:ChunkSize])
 	if err != nil {
 		return
 	}
-	err = readChunk(file, fi.Size()-ChunkSize, buf[ChunkSize:])
+	err = readChunk(r, size-ChunkSize, buf[ChunkSize:])
 	if err != nil {
 		return
 	}
@@ -71,7 +82,7 @@ func HashFile(file *os.File) (hash uint64, err error) {
 		hash += num
 	}
 
-	return hash + uint64(fi.Size()), nil
+	return hash + uint64(size), nil
 }
 
 // Hash generates an OSDB hash for a file.
@@ -84,14 +95,15 @@ func Hash(path string) (uint64, error) {
 	return HashFile(file)
 }
 
-// Read a chunk of a file at `offset` so as to fill `buf`.
-func readChunk(file *os.File, offset int64, buf []byte) (err error) {
-	n, err := file.ReadAt(buf, offset)
+// Read a chunk of r at `offset` so as to fill `buf`.
+func readChunk(r io.ReaderAt, offset int64, buf []byte) (err error) {
+	n, err := r.ReadAt(buf, offset)
+	if n == len(buf) {
+		// ReaderAt may return io.EOF along with the last bytes.
+		return nil
+	}
 	if err != nil {
 		return
 	}
-	if n != ChunkSize {
-		return fmt.Errorf("Invalid read %v", n)
-	}
-	return
+	return fmt.Errorf("Invalid read %v", n)
 }
@@ -1,6 +1,8 @@
 package osdb
 
 import (
+	"bytes"
+	"io"
 	"io/ioutil"
 	"os"
 	"testing"
@@ -47,6 +49,45 @@ func TestHashWithSample(t *testing.T) {
 	}
 }
 
+// A ReaderAt returning io.EOF along with the last bytes, as allowed by
+// the io.ReaderAt contract.
+type eofReaderAt struct{ *bytes.Reader }
+
+func (r eofReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	n, err := r.Reader.ReadAt(p, off)
+	if err == nil && off+int64(n) == r.Size() {
+		err = io.EOF
+	}
+	return n, err
+}
+
+func TestHashReaderAtWithSample(t *testing.T) {
+	data := make([]byte, ChunkSize*2)
+	var dataHash uint64 = 0x6c62616c62636cc3
+	copy(data, []byte("blablabla"))
+
+	for _, r := range []io.ReaderAt{bytes.NewReader(data), eofReaderAt{bytes.NewReader(data)}} {
+		hash, err := HashReaderAt(r, int64(len(data)))
+		if err != nil {
+			t.Fatalf("Expected hash, got error: %v", err)
+		}
+		if hash != dataHash {
+			t.Fatalf("Expected hash 0x%016x, got 0x%016x", dataHash, hash)
+		}
+	}
+}
+
+func TestHashReaderAtErrors(t *testing.T) {
+	data := make([]byte, ChunkSize*2)
+	if _, err := HashReaderAt(bytes.NewReader(data), ChunkSize-1); err == nil {
+		t.Fatalf("Expected an error for a too small size, got none")
+	}
+	// Size is larger than the content: the tail can't be read.
+	if _, err := HashReaderAt(bytes.NewReader(data), ChunkSize*3); err == nil {
+		t.Fatalf("Expected an error for a short read, got none")
+	}
+}
+
 func TestNewClient(t *testing.T) {
 	_, err := NewClient()
 	if err != nil {
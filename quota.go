@@ -0,0 +1,131 @@
+package osdb
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DownloadLimitStatus starts the status of downloads refused by OSDB,
+// once the download quota is used.
+const DownloadLimitStatus = "407"
+
+// QuotaPeriod is the period over which OSDB counts downloads.
+const QuotaPeriod = 24 * time.Hour
+
+// DownloadLimitError is returned for downloads refused by OSDB, once the
+// download quota is used.
+// OSDB doesn't tell when downloads are allowed again.
+type DownloadLimitError struct {
+	Status string
+}
+
+func (e *DownloadLimitError) Error() string {
+	return fmt.Sprintf("download limit reached (%s)", e.Status)
+}
+
+// Quota holds download limits, as counted by OSDB for the client's IP
+// address, or for its user when logged in.
+type Quota struct {
+	Limit     int    // downloads allowed per QuotaPeriod
+	Used      int    // downloads counted by OSDB in the current period
+	CheckedBy string // "ip" or "user_id"
+
+	// Downloads made by this client, in total and since the quota was
+	// read from OSDB.
+	Session int
+	Since   int
+}
+
+// Remaining downloads, or -1 when the limit is unknown.
+func (q Quota) Remaining() int {
+	if q.Limit <= 0 {
+		return -1
+	}
+	if n := q.Limit - q.Used - q.Since; n > 0 {
+		return n
+	}
+	return 0
+}
+
+// ServerInfo returns information about OSDB's servers, such as the
+// application version, and the client's download limits.
+func (c *Client) ServerInfo() (map[string]interface{}, error) {
+	res := map[string]interface{}{}
+	if err := c.Call("ServerInfo", []interface{}{}, &res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// Quota reads the client's download quota from ServerInfo. Downloads
+// made afterwards are counted in Quota.Since.
+//
+// GetUserInfo can't be used for this: it only returns a user's total
+// number of downloads, without a daily count or limit. When logged in,
+// ServerInfo counts downloads per user instead, with CheckedBy set to
+// "user_id".
+func (c *Client) Quota() (Quota, error) {
+	info, err := c.ServerInfo()
+	if err != nil {
+		return Quota{}, err
+	}
+	limits, ok := info["download_limits"].(map[string]interface{})
+	if !ok {
+		return Quota{}, fmt.Errorf("ServerInfo returned no download limits")
+	}
+	q := Quota{
+		Limit:     intValue(limits["client_24h_download_limit"]),
+		Used:      intValue(limits["client_24h_download_count"]),
+		CheckedBy: fmt.Sprint(limits["limit_check_by"]),
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.downloadsChecked = c.downloads
+	q.Session = c.downloads
+	return q, nil
+}
+
+// SessionQuota returns the last quota read with Quota, updated with the
+// downloads made since, without calling OSDB.
+func (c *Client) SessionQuota(q Quota) Quota {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	q.Session = c.downloads
+	q.Since = c.downloads - c.downloadsChecked
+	return q
+}
+
+// Count downloaded files.
+func (c *Client) countDownloads(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.downloads += n
+}
+
+// QuotaError builds the error of downloads refused with status, e.g.
+// to stop before using more than the Quota.
+func (c *Client) QuotaError(status string) *DownloadLimitError {
+	return &DownloadLimitError{Status: status}
+}
+
+// Whether a response status means the download quota is used.
+func isDownloadLimit(status string) bool {
+	return strings.HasPrefix(status, DownloadLimitStatus)
+}
+
+// Read XML-RPC numbers, sent as integers or strings.
+func intValue(v interface{}) int {
+	switch v := v.(type) {
+	case int64:
+		return int(v)
+	case int:
+		return v
+	case string:
+		n, _ := strconv.Atoi(v)
+		return n
+	}
+	return 0
+}
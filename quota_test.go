@@ -0,0 +1,78 @@
+package osdb
+
+import (
+	"testing"
+)
+
+func TestQuota(t *testing.T) {
+	c, done := newTestServer(t, func(method string, body []byte) interface{} {
+		switch method {
+		case "ServerInfo":
+			return map[string]interface{}{
+				"application": "OpenSuber v0.2",
+				"download_limits": map[string]interface{}{
+					"client_ip":                 "127.0.0.1",
+					"limit_check_by":            "ip",
+					"client_24h_download_count": "195",
+					"client_24h_download_limit": 200,
+				},
+			}
+		case "DownloadSubtitles":
+			sf := newTestSubtitleFile([]byte("sub"))
+			return map[string]interface{}{
+				"status": StatusSuccess,
+				"data":   []map[string]string{{"idsubtitlefile": "1", "data": sf.Data}},
+			}
+		}
+		t.Errorf("Unexpected call to %s", method)
+		return nil
+	})
+	defer done()
+
+	c.BatchDownload([]int{1})
+	q, err := c.Quota()
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if q.Limit != 200 || q.Used != 195 || q.CheckedBy != "ip" || q.Session != 1 {
+		t.Fatalf("Unexpected quota: %+v", q)
+	}
+	if q.Remaining() != 5 {
+		t.Fatalf("Expected 5 downloads left, got %d", q.Remaining())
+	}
+
+	c.BatchDownload([]int{1})
+	c.BatchDownload([]int{1})
+	q = c.SessionQuota(q)
+	if q.Session != 3 || q.Since != 2 || q.Remaining() != 3 {
+		t.Fatalf("Expected 2 more downloads, got %+v", q)
+	}
+
+	if (Quota{}).Remaining() != -1 {
+		t.Fatalf("Expected an unknown quota without limit")
+	}
+}
+
+func TestBatchDownloadLimit(t *testing.T) {
+	calls := 0
+	c, done := newTestServer(t, func(method string, body []byte) interface{} {
+		calls++
+		return map[string]interface{}{"status": "407 Download limit reached"}
+	})
+	defer done()
+
+	ids := make([]int, DownloadBatchSize*3)
+	results := c.BatchDownload(ids)
+	if calls != 1 {
+		t.Fatalf("Expected to stop after the first refused call, made %d", calls)
+	}
+	for i, r := range results {
+		err, ok := r.Err.(*DownloadLimitError)
+		if !ok {
+			t.Fatalf("Expected a DownloadLimitError for result %d, got %v", i, r.Err)
+		}
+		if err.Status != "407 Download limit reached" {
+			t.Fatalf("Unexpected error: %+v", err)
+		}
+	}
+}
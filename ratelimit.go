@@ -0,0 +1,59 @@
+package osdb
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultRateLimit is the number of API calls allowed by OSDB in
+	// DefaultRatePeriod, per IP address.
+	DefaultRateLimit = 40
+
+	// DefaultRatePeriod is the period of DefaultRateLimit.
+	DefaultRatePeriod = 10 * time.Second
+)
+
+// A sliding window limiter: at most limit calls in any period.
+type rateLimiter struct {
+	mu    sync.Mutex
+	calls []time.Time // start of the last calls, oldest first
+
+	now   func() time.Time
+	sleep func(time.Duration)
+}
+
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{now: time.Now, sleep: time.Sleep}
+}
+
+// Wait until a call can be made without exceeding limit calls per
+// period, and record it. A limit of 0 or less disables waiting.
+func (l *rateLimiter) wait(limit int, period time.Duration) {
+	if limit <= 0 || period <= 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	for len(l.calls) > 0 && now.Sub(l.calls[0]) >= period {
+		l.calls = l.calls[1:]
+	}
+	if len(l.calls) >= limit {
+		// Holding the lock makes other callers queue up behind us.
+		l.sleep(l.calls[len(l.calls)-limit].Add(period).Sub(now))
+		now = l.now()
+		l.calls = l.calls[len(l.calls)-limit+1:]
+	}
+	l.calls = append(l.calls, now)
+}
+
+// Call invokes an API method, waiting first when needed to stay within
+// the client's RateLimit. It is safe for concurrent use.
+func (c *Client) Call(method string, args interface{}, reply interface{}) error {
+	if c.limiter != nil {
+		c.limiter.wait(c.RateLimit, c.RatePeriod)
+	}
+	return c.Client.Call(method, args, reply)
+}
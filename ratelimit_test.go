@@ -0,0 +1,56 @@
+package osdb
+
+import (
+	"testing"
+	"time"
+)
+
+// A rate limiter with a fake clock, which moves when sleeping.
+func newTestRateLimiter() (*rateLimiter, *time.Duration) {
+	start := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	var elapsed time.Duration
+	l := newRateLimiter()
+	l.now = func() time.Time { return start.Add(elapsed) }
+	l.sleep = func(d time.Duration) { elapsed += d }
+	return l, &elapsed
+}
+
+func TestRateLimiterBurst(t *testing.T) {
+	l, elapsed := newTestRateLimiter()
+	for i := 0; i < 3; i++ {
+		l.wait(3, 10*time.Second)
+	}
+	if *elapsed != 0 {
+		t.Fatalf("Expected no wait within the limit, waited %s", *elapsed)
+	}
+
+	l.wait(3, 10*time.Second)
+	if *elapsed != 10*time.Second {
+		t.Fatalf("Expected to wait 10s, waited %s", *elapsed)
+	}
+}
+
+func TestRateLimiterWindow(t *testing.T) {
+	l, elapsed := newTestRateLimiter()
+	l.wait(2, 10*time.Second) // t=0
+	*elapsed = 4 * time.Second
+	l.wait(2, 10*time.Second) // t=4
+	l.wait(2, 10*time.Second) // waits for the first call to expire
+	if *elapsed != 10*time.Second {
+		t.Fatalf("Expected to wait until 10s, got %s", *elapsed)
+	}
+	l.wait(2, 10*time.Second) // waits for the call at t=4
+	if *elapsed != 14*time.Second {
+		t.Fatalf("Expected to wait until 14s, got %s", *elapsed)
+	}
+}
+
+func TestRateLimiterDisabled(t *testing.T) {
+	l, elapsed := newTestRateLimiter()
+	for i := 0; i < 100; i++ {
+		l.wait(0, 10*time.Second)
+	}
+	if *elapsed != 0 || len(l.calls) != 0 {
+		t.Fatalf("Expected no limit, waited %s", *elapsed)
+	}
+}
@@ -0,0 +1,174 @@
+package osdb
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// RangeError is returned when an HTTP server doesn't answer Range
+// requests with partial content, so that files can't be hashed without
+// downloading them whole.
+type RangeError struct {
+	URL    string
+	Status string
+}
+
+func (e *RangeError) Error() string {
+	return fmt.Sprintf("%s: server ignores HTTP Range requests (%s)", e.URL, e.Status)
+}
+
+// HTTPReaderAt reads a remote file with HTTP Range requests, one per
+// ReadAt call.
+type HTTPReaderAt struct {
+	URL    string
+	Client *http.Client
+
+	size int64
+}
+
+// NewHTTPReaderAt returns a reader for the file at url, and gets its
+// size with a HEAD request, or a one byte Range request when HEAD
+// doesn't tell. A nil client uses http.DefaultClient.
+func NewHTTPReaderAt(client *http.Client, url string) (*HTTPReaderAt, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	r := &HTTPReaderAt{URL: url, Client: client, size: -1}
+
+	res, err := client.Head(url)
+	if err != nil {
+		return nil, err
+	}
+	res.Body.Close()
+	if res.StatusCode == http.StatusOK {
+		if strings.EqualFold(res.Header.Get("Accept-Ranges"), "none") {
+			return nil, &RangeError{url, "Accept-Ranges: none"}
+		}
+		r.size = res.ContentLength
+	}
+	if r.size >= 0 {
+		return r, nil
+	}
+
+	res, err = r.get(0, 0)
+	if err != nil {
+		return nil, err
+	}
+	res.Body.Close()
+	if _, _, r.size, err = contentRange(res.Header.Get("Content-Range")); err != nil {
+		return nil, fmt.Errorf("%s: %s", url, err)
+	}
+	if r.size < 0 {
+		return nil, fmt.Errorf("%s: unknown file size", url)
+	}
+	return r, nil
+}
+
+// Size of the remote file.
+func (r *HTTPReaderAt) Size() int64 {
+	return r.size
+}
+
+// ReadAt reads len(p) bytes at off, or up to the end of the file, with
+// a single Range request.
+func (r *HTTPReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if off >= r.size {
+		return 0, io.EOF
+	}
+	want := int64(len(p))
+	if off+want > r.size {
+		want = r.size - off
+	}
+	if want == 0 {
+		return 0, nil
+	}
+
+	res, err := r.get(off, off+want-1)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	start, _, _, err := contentRange(res.Header.Get("Content-Range"))
+	if err != nil {
+		return 0, fmt.Errorf("%s: %s", r.URL, err)
+	}
+	if start != off {
+		return 0, fmt.Errorf("%s: asked bytes from %d, got them from %d", r.URL, off, start)
+	}
+
+	n, err := io.ReadFull(res.Body, p[:want])
+	if err != nil {
+		return n, io.ErrUnexpectedEOF
+	}
+	if want < int64(len(p)) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// Send a GET request for the bytes from start to end, included, and
+// check that the server answered with partial content.
+func (r *HTTPReaderAt) get(start int64, end int64) (*http.Response, error) {
+	req, err := http.NewRequest("GET", r.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, end))
+	res, err := r.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	switch res.StatusCode {
+	case http.StatusPartialContent:
+		return res, nil
+	case http.StatusOK:
+		// The whole file is coming: don't read it.
+		res.Body.Close()
+		return nil, &RangeError{r.URL, res.Status}
+	default:
+		res.Body.Close()
+		return nil, fmt.Errorf("%s: %s", r.URL, res.Status)
+	}
+}
+
+// Parse a Content-Range header, e.g. "bytes 0-65535/734003200". The
+// size is -1 when the server doesn't know it.
+func contentRange(h string) (start int64, end int64, size int64, err error) {
+	bad := fmt.Errorf("invalid Content-Range %q", h)
+	if !strings.HasPrefix(h, "bytes ") {
+		return 0, 0, 0, bad
+	}
+	parts := strings.SplitN(strings.TrimPrefix(h, "bytes "), "/", 2)
+	bounds := strings.SplitN(parts[0], "-", 2)
+	if len(parts) != 2 || len(bounds) != 2 {
+		return 0, 0, 0, bad
+	}
+	if start, err = strconv.ParseInt(bounds[0], 10, 64); err != nil {
+		return 0, 0, 0, bad
+	}
+	if end, err = strconv.ParseInt(bounds[1], 10, 64); err != nil || end < start {
+		return 0, 0, 0, bad
+	}
+	size = -1
+	if parts[1] != "*" {
+		if size, err = strconv.ParseInt(parts[1], 10, 64); err != nil {
+			return 0, 0, 0, bad
+		}
+	}
+	return start, end, size, nil
+}
+
+// HashURL generates an OSDB hash for a remote file, with three HTTP
+// requests: one for its size, and two Range requests for its first and
+// last ChunkSize bytes. It also returns the file size.
+func HashURL(url string) (hash uint64, size int64, err error) {
+	r, err := NewHTTPReaderAt(nil, url)
+	if err != nil {
+		return 0, 0, err
+	}
+	hash, err = HashReaderAt(r, r.Size())
+	return hash, r.Size(), err
+}
@@ -0,0 +1,82 @@
+package osdb
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// Serve data with Range support, counting requests per method. Without
+// head, HEAD requests are refused.
+func newRangeServer(data []byte, head bool, counts map[string]int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		counts[r.Method]++
+		if r.Method == "HEAD" && !head {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		http.ServeContent(w, r, "movie.avi", time.Time{}, bytes.NewReader(data))
+	}))
+}
+
+func TestHashURL(t *testing.T) {
+	data := make([]byte, ChunkSize*3)
+	copy(data, []byte("blablabla"))
+	want, _ := HashReaderAt(bytes.NewReader(data), int64(len(data)))
+
+	for _, head := range []bool{true, false} {
+		counts := map[string]int{}
+		srv := newRangeServer(data, head, counts)
+		hash, size, err := HashURL(srv.URL + "/movie.avi")
+		srv.Close()
+		if err != nil {
+			t.Fatalf("Expected hash, got error: %v", err)
+		}
+		if hash != want || size != int64(len(data)) {
+			t.Fatalf("Expected hash 0x%016x of %d bytes, got 0x%016x of %d", want, len(data), hash, size)
+		}
+		gets := 2
+		if !head {
+			gets = 3 // one more to get the size
+		}
+		if counts["HEAD"] != 1 || counts["GET"] != gets {
+			t.Fatalf("Expected 1 HEAD and %d GET, got %v", gets, counts)
+		}
+	}
+}
+
+func TestHashURLWithoutRanges(t *testing.T) {
+	data := make([]byte, ChunkSize*2)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(data)
+	}))
+	defer srv.Close()
+
+	_, _, err := HashURL(srv.URL + "/movie.avi")
+	if _, ok := err.(*RangeError); !ok {
+		t.Fatalf("Expected a *RangeError, got %v", err)
+	}
+}
+
+func TestHTTPReaderAt(t *testing.T) {
+	data := []byte("0123456789")
+	srv := newRangeServer(data, true, map[string]int{})
+	defer srv.Close()
+
+	r, err := NewHTTPReaderAt(nil, srv.URL)
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if r.Size() != 10 {
+		t.Fatalf("Expected size 10, got %d", r.Size())
+	}
+	buf := make([]byte, 4)
+	if n, err := r.ReadAt(buf, 3); n != 4 || err != nil || string(buf) != "3456" {
+		t.Fatalf("Unexpected read %q (%d), error: %v", buf[:n], n, err)
+	}
+	if n, err := r.ReadAt(buf, 8); n != 2 || err == nil || string(buf[:n]) != "89" {
+		t.Fatalf("Expected a short read of 89 and io.EOF, got %q, %v", buf[:n], err)
+	}
+}
@@ -0,0 +1,265 @@
+package osdb
+
+import (
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultSearchTTL is how long search results are cached by default.
+const DefaultSearchTTL = 24 * time.Hour
+
+// ResponseCache keeps OSDB responses on disk, so that the same searches
+// and downloads are not sent again. Search results expire after
+// SearchTTL, while subtitle files are kept until cleared: their content
+// never changes for a given IDSubtitleFile. Empty search results are
+// cached too, for the whole TTL: subtitles uploaded in the meantime are
+// only found once they expire.
+//
+// The cache is best effort: it is skipped when it can't be read or
+// written. A nil *ResponseCache caches nothing.
+type ResponseCache struct {
+	Dir       string
+	SearchTTL time.Duration // 0 disables the search results cache
+	ReadOnly  bool          // serve cached responses, without storing new ones
+
+	now func() time.Time
+}
+
+// CacheStats describes the content of a ResponseCache.
+type CacheStats struct {
+	Searches int   // cached search results
+	Expired  int   // among Searches, those past their TTL
+	Files    int   // cached subtitle files
+	Size     int64 // in bytes, on disk
+}
+
+// Cached search results, with the criteria they were searched with.
+type cachedSearch struct {
+	Time      time.Time       `json:"time"`
+	Criteria  json.RawMessage `json:"criteria"`
+	Subtitles Subtitles       `json:"subtitles"`
+}
+
+// A cached subtitle file, still compressed and encoded like OSDB sends
+// it.
+type cachedFile struct {
+	Time time.Time `json:"time"`
+	ID   string    `json:"id"`
+	Data string    `json:"data"`
+}
+
+// NewResponseCache returns a cache stored in dir, keeping search results
+// for ttl.
+func NewResponseCache(dir string, ttl time.Duration) *ResponseCache {
+	return &ResponseCache{Dir: dir, SearchTTL: ttl, now: time.Now}
+}
+
+func (rc *ResponseCache) clock() time.Time {
+	if rc.now == nil {
+		return time.Now()
+	}
+	return rc.now()
+}
+
+func (rc *ResponseCache) searchDir() string { return filepath.Join(rc.Dir, "searches") }
+func (rc *ResponseCache) filesDir() string  { return filepath.Join(rc.Dir, "files") }
+
+// Key of search criteria: the arguments of SearchSubtitles, without the
+// session token.
+func searchKey(criteria interface{}) ([]byte, string) {
+	data, err := json.Marshal(criteria)
+	if err != nil {
+		return nil, ""
+	}
+	return data, fmt.Sprintf("%x", sha1.Sum(data))
+}
+
+// Look up search results, or return false when they are missing or
+// expired.
+func (rc *ResponseCache) search(criteria interface{}) (Subtitles, bool) {
+	if rc == nil || rc.SearchTTL <= 0 {
+		return nil, false
+	}
+	_, key := searchKey(criteria)
+	if key == "" {
+		return nil, false
+	}
+	data, err := ioutil.ReadFile(filepath.Join(rc.searchDir(), key+".json"))
+	if err != nil {
+		return nil, false
+	}
+	var entry cachedSearch
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, false
+	}
+	if rc.clock().Sub(entry.Time) > rc.SearchTTL {
+		return nil, false
+	}
+	return entry.Subtitles, true
+}
+
+func (rc *ResponseCache) putSearch(criteria interface{}, subs Subtitles) {
+	if rc == nil || rc.ReadOnly || rc.SearchTTL <= 0 {
+		return
+	}
+	raw, key := searchKey(criteria)
+	if key == "" {
+		return
+	}
+	data, err := json.Marshal(cachedSearch{rc.clock(), raw, subs})
+	if err == nil {
+		writeFileAtomic(filepath.Join(rc.searchDir(), key+".json"), data)
+	}
+}
+
+// Look up a subtitle file by ID, nil when it is not cached.
+func (rc *ResponseCache) file(id int) *SubtitleFile {
+	if rc == nil {
+		return nil
+	}
+	data, err := ioutil.ReadFile(filepath.Join(rc.filesDir(), strconv.Itoa(id)+".json"))
+	if err != nil {
+		return nil
+	}
+	var entry cachedFile
+	if err := json.Unmarshal(data, &entry); err != nil || entry.ID != strconv.Itoa(id) {
+		return nil
+	}
+	return &SubtitleFile{ID: entry.ID, Data: entry.Data}
+}
+
+// HasFile tells whether the subtitle file of an IDSubtitleFile is
+// cached: downloading it doesn't count in the quota.
+func (rc *ResponseCache) HasFile(id string) bool {
+	n, err := strconv.Atoi(id)
+	return err == nil && rc.file(n) != nil
+}
+
+func (rc *ResponseCache) putFile(sf *SubtitleFile) {
+	if rc == nil || rc.ReadOnly {
+		return
+	}
+	if _, err := strconv.Atoi(sf.ID); err != nil {
+		return // not safe as a file name
+	}
+	data, err := json.Marshal(cachedFile{rc.clock(), sf.ID, sf.Data})
+	if err == nil {
+		writeFileAtomic(filepath.Join(rc.filesDir(), sf.ID+".json"), data)
+	}
+}
+
+// Stats counts the cached search results and files.
+func (rc *ResponseCache) Stats() (CacheStats, error) {
+	var stats CacheStats
+	err := rc.walk(rc.searchDir(), func(path string, fi os.FileInfo) {
+		stats.Searches++
+		stats.Size += fi.Size()
+		if rc.expired(path) {
+			stats.Expired++
+		}
+	})
+	if err != nil {
+		return stats, err
+	}
+	err = rc.walk(rc.filesDir(), func(path string, fi os.FileInfo) {
+		stats.Files++
+		stats.Size += fi.Size()
+	})
+	return stats, err
+}
+
+// ClearSearches removes cached search results: all of them, or only the
+// expired ones. It returns the number of results removed.
+func (rc *ResponseCache) ClearSearches(expiredOnly bool) (int, error) {
+	removed := 0
+	var errs []string
+	err := rc.walk(rc.searchDir(), func(path string, fi os.FileInfo) {
+		if expiredOnly && !rc.expired(path) {
+			return
+		}
+		if err := os.Remove(path); err != nil {
+			errs = append(errs, err.Error())
+			return
+		}
+		removed++
+	})
+	if err == nil && len(errs) > 0 {
+		err = fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return removed, err
+}
+
+// ClearFiles removes all the cached subtitle files, and returns their
+// number.
+func (rc *ResponseCache) ClearFiles() (int, error) {
+	stats, err := rc.Stats()
+	if err != nil {
+		return 0, err
+	}
+	return stats.Files, os.RemoveAll(rc.filesDir())
+}
+
+// Call fn for the cache entries in dir, which may not exist yet.
+func (rc *ResponseCache) walk(dir string, fn func(path string, fi os.FileInfo)) error {
+	entries, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, fi := range entries {
+		if fi.Mode().IsRegular() && filepath.Ext(fi.Name()) == ".json" {
+			fn(filepath.Join(dir, fi.Name()), fi)
+		}
+	}
+	return nil
+}
+
+// Whether a cached search result is past its TTL, or unreadable.
+func (rc *ResponseCache) expired(path string) bool {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return true
+	}
+	var entry struct {
+		Time time.Time `json:"time"`
+	}
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return true
+	}
+	return rc.clock().Sub(entry.Time) > rc.SearchTTL
+}
+
+// Write a file through a temporary one, so that it is never seen
+// half-written.
+func writeFileAtomic(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
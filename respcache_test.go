@@ -0,0 +1,167 @@
+package osdb
+
+import (
+	"io/ioutil"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func newTestCache(t *testing.T) (*ResponseCache, *time.Time, func()) {
+	dir, err := ioutil.TempDir("", "osdb")
+	if err != nil {
+		t.Fatalf("Can't create temp dir: %s", err)
+	}
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	rc := NewResponseCache(dir, time.Hour)
+	rc.now = func() time.Time { return now }
+	return rc, &now, func() { os.RemoveAll(dir) }
+}
+
+func TestResponseCacheSearch(t *testing.T) {
+	calls := 0
+	sent := 0 // criteria sent in the last call
+	c, done := newTestServer(t, func(method string, body []byte) interface{} {
+		calls++
+		criteria := []struct {
+			Hash string `xmlrpc:"moviehash"`
+		}{}
+		requestParam(t, body, 1, &criteria)
+		sent = len(criteria)
+		data := []map[string]string{}
+		for i, cr := range criteria {
+			data = append(data, map[string]string{
+				"IDSubtitleFile": cr.Hash,
+				"QueryNumber":    strconv.Itoa(i),
+			})
+		}
+		return map[string]interface{}{"status": StatusSuccess, "data": data}
+	})
+	defer done()
+	rc, now, clean := newTestCache(t)
+	defer clean()
+	c.Cache = rc
+
+	for i := 0; i < 2; i++ {
+		subs, err := c.HashSearch(1, 100000, []string{"eng"})
+		if err != nil || len(subs) != 1 {
+			t.Fatalf("Unexpected results %v, error: %v", subs, err)
+		}
+	}
+	if calls != 1 {
+		t.Fatalf("Expected 1 call, got %d", calls)
+	}
+
+	// Batches share the cache of single searches, and only send the
+	// missing queries.
+	results, err := c.BatchHashSearch([]HashQuery{
+		{Hash: 2, Size: 100000, Langs: []string{"eng"}},
+		{Hash: 1, Size: 100000, Langs: []string{"eng"}},
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if calls != 2 || sent != 1 {
+		t.Fatalf("Expected a second call with 1 query, got %d calls, %d queries", calls, sent)
+	}
+	for i, want := range []string{hashString(2), hashString(1)} {
+		if len(results[i]) != 1 || results[i][0].IDSubtitleFile != want {
+			t.Fatalf("Unexpected results for query %d: %v", i, results[i])
+		}
+	}
+	if _, err := c.BatchHashSearch([]HashQuery{{Hash: 2, Size: 100000, Langs: []string{"eng"}}}); err != nil || calls != 2 {
+		t.Fatalf("Expected a cached batch, got %d calls, error: %v", calls, err)
+	}
+
+	stats, err := rc.Stats()
+	if err != nil || stats.Searches != 2 || stats.Expired != 0 {
+		t.Fatalf("Unexpected stats %+v, error: %v", stats, err)
+	}
+
+	// Expired results are searched again.
+	*now = now.Add(2 * time.Hour)
+	if stats, _ := rc.Stats(); stats.Expired != 2 {
+		t.Fatalf("Expected 2 expired searches, got %+v", stats)
+	}
+	c.HashSearch(1, 100000, []string{"eng"})
+	if calls != 3 {
+		t.Fatalf("Expected 3 calls, got %d", calls)
+	}
+	if n, err := rc.ClearSearches(true); n != 1 || err != nil {
+		t.Fatalf("Expected 1 expired search removed, got %d, error: %v", n, err)
+	}
+	if n, err := rc.ClearSearches(false); n != 1 || err != nil {
+		t.Fatalf("Expected 1 search removed, got %d, error: %v", n, err)
+	}
+}
+
+func TestResponseCacheDownload(t *testing.T) {
+	calls := 0
+	c, done := newTestServer(t, func(method string, body []byte) interface{} {
+		calls++
+		ids := []int{}
+		requestParam(t, body, 1, &ids)
+		data := []map[string]string{}
+		for _, id := range ids {
+			sf := newTestSubtitleFile([]byte("sub " + strconv.Itoa(id)))
+			data = append(data, map[string]string{"idsubtitlefile": strconv.Itoa(id), "data": sf.Data})
+		}
+		return map[string]interface{}{"status": StatusSuccess, "data": data}
+	})
+	defer done()
+	rc, _, clean := newTestCache(t)
+	defer clean()
+	c.Cache = rc
+
+	c.BatchDownload([]int{1, 2})
+	results := c.BatchDownload([]int{2, 3, 1})
+	if calls != 2 {
+		t.Fatalf("Expected 2 calls, got %d", calls)
+	}
+	for i, id := range []int{2, 3, 1} {
+		if results[i].Err != nil {
+			t.Fatalf("Unexpected error for ID %d: %s", id, results[i].Err)
+		}
+		data, _ := results[i].File.Bytes()
+		if string(data) != "sub "+strconv.Itoa(id) {
+			t.Fatalf("Unexpected file for ID %d: %q", id, data)
+		}
+	}
+	if c.downloads != 3 {
+		t.Fatalf("Expected 3 downloads counted, got %d", c.downloads)
+	}
+
+	if !rc.HasFile("3") || rc.HasFile("4") || rc.HasFile("x") {
+		t.Fatalf("Expected only files 1 to 3 to be cached")
+	}
+	if n, err := rc.ClearFiles(); n != 3 || err != nil {
+		t.Fatalf("Expected 3 files removed, got %d, error: %v", n, err)
+	}
+	c.BatchDownload([]int{1})
+	if calls != 3 {
+		t.Fatalf("Expected 3 calls, got %d", calls)
+	}
+}
+
+func TestResponseCacheReadOnly(t *testing.T) {
+	calls := 0
+	c, done := newTestServer(t, func(method string, body []byte) interface{} {
+		calls++
+		return map[string]interface{}{"status": StatusSuccess, "data": []map[string]string{}}
+	})
+	defer done()
+	rc, _, clean := newTestCache(t)
+	defer clean()
+	rc.ReadOnly = true
+	c.Cache = rc
+
+	c.HashSearch(1, 100000, []string{"eng"})
+	c.HashSearch(1, 100000, []string{"eng"})
+	if calls != 2 {
+		t.Fatalf("Expected 2 calls, got %d", calls)
+	}
+	if stats, err := rc.Stats(); err != nil || stats.Searches != 0 || stats.Files != 0 {
+		t.Fatalf("Expected an empty cache, got %+v, error: %v", stats, err)
+	}
+}
@@ -0,0 +1,205 @@
+package osdb
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/encoding/ianaindex"
+)
+
+// BOMPolicy tells how a byte order mark is handled when saving subtitles.
+type BOMPolicy int
+
+const (
+	// BOMKeep writes a BOM only if the downloaded file had one.
+	BOMKeep BOMPolicy = iota
+	// BOMStrip never writes a BOM.
+	BOMStrip
+	// BOMAdd always writes a BOM. Only Unicode encodings can represent it.
+	BOMAdd
+)
+
+// LineEnding tells how line endings are normalized when saving subtitles.
+type LineEnding int
+
+const (
+	// LineEndingKeep leaves line endings untouched.
+	LineEndingKeep LineEnding = iota
+	// LineEndingLF converts all line endings to "\n".
+	LineEndingLF
+	// LineEndingCRLF converts all line endings to "\r\n".
+	LineEndingCRLF
+)
+
+const bom = '\uFEFF'
+
+// SaveOptions control how a subtitle file is written to disk. The zero
+// value writes UTF-8 text, keeping the BOM and line endings as they were.
+type SaveOptions struct {
+	// Encoding of the written file, UTF-8 when nil.
+	Encoding encoding.Encoding
+	BOM      BOMPolicy
+	EOL      LineEnding
+	// Substitute replaces characters that Encoding cannot represent
+	// with '?', instead of refusing to write the file.
+	Substitute bool
+}
+
+// UnmappableChar is a character that the target encoding can not
+// represent.
+type UnmappableChar struct {
+	Line   int // 1-based
+	Column int // 1-based, counted in characters
+	Rune   rune
+}
+
+// UnmappableError reports all the characters that could not be encoded
+// when saving a subtitle file. When SaveOptions.Substitute is set, the
+// file was still written, with '?' in place of these characters.
+type UnmappableError struct {
+	Chars []UnmappableChar
+}
+
+func (e *UnmappableError) Error() string {
+	if len(e.Chars) == 0 {
+		return "unmappable characters"
+	}
+	c := e.Chars[0]
+	return fmt.Sprintf(
+		"%d unmappable character(s), first is %q at line %d, column %d",
+		len(e.Chars), c.Rune, c.Line, c.Column,
+	)
+}
+
+// EncodingByName finds a character encoding by its IANA or WHATWG name,
+// such as "windows-1250", or "ISO-8859-2". Unlike the lookup used for
+// OSDB's own encoding names, unknown names are an error.
+func EncodingByName(name string) (encoding.Encoding, error) {
+	if enc, err := ianaindex.IANA.Encoding(name); err == nil && enc != nil {
+		return enc, nil
+	}
+	if enc, err := htmlindex.Get(name); err == nil && enc != nil {
+		return enc, nil
+	}
+	return nil, fmt.Errorf("unknown encoding %q", name)
+}
+
+// Save reads UTF-8 text from r, and writes it to w according to opts.
+func (opts SaveOptions) Save(w io.Writer, r io.Reader) error {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	out, err := opts.encode(data)
+	if out != nil {
+		if _, werr := w.Write(out); werr != nil {
+			return werr
+		}
+	}
+	return err
+}
+
+// Encode UTF-8 text according to opts. With a nil result, the error is
+// fatal and nothing should be written.
+func (opts SaveOptions) encode(data []byte) ([]byte, error) {
+	text := string(data)
+	hadBOM := strings.HasPrefix(text, string(bom))
+	text = strings.TrimPrefix(text, string(bom))
+
+	switch opts.EOL {
+	case LineEndingLF:
+		text = normalizeEOL(text, "\n")
+	case LineEndingCRLF:
+		text = normalizeEOL(text, "\r\n")
+	}
+
+	wantBOM := opts.BOM == BOMAdd || (opts.BOM == BOMKeep && hadBOM)
+	if opts.Encoding == nil {
+		if wantBOM {
+			text = string(bom) + text
+		}
+		return []byte(text), nil
+	}
+
+	// Some encoders, such as UTF-16 with a BOM, write their own BOM
+	// before any text.
+	ownBOM, _ := opts.Encoding.NewEncoder().String("")
+	prefix := ""
+	if wantBOM && ownBOM == "" {
+		if _, err := opts.Encoding.NewEncoder().String(string(bom)); err == nil {
+			prefix = string(bom)
+		} else if opts.BOM == BOMAdd {
+			return nil, fmt.Errorf("encoding can not represent a BOM")
+		}
+	}
+
+	// Encode the text in one pass, and only look for unmappable
+	// characters when it fails.
+	encoded, err := opts.Encoding.NewEncoder().String(prefix + text)
+	var report UnmappableError
+	if err != nil {
+		text, report.Chars = opts.substitute(text)
+		if encoded, err = opts.Encoding.NewEncoder().String(prefix + text); err != nil {
+			return nil, err
+		}
+	}
+	if !wantBOM {
+		encoded = strings.TrimPrefix(encoded, ownBOM)
+	}
+
+	if len(report.Chars) == 0 {
+		return []byte(encoded), nil
+	}
+	if !opts.Substitute {
+		return nil, &report
+	}
+	return []byte(encoded), &report
+}
+
+// Find the characters of text that opts.Encoding can't represent, one
+// at a time, and replace them with '?'. Invalid UTF-8 can't be encoded,
+// while a U+FFFD of the text is a character like any other. BOMs in the
+// middle of the text are dropped.
+func (opts SaveOptions) substitute(text string) (string, []UnmappableChar) {
+	var (
+		out   bytes.Buffer
+		chars []UnmappableChar
+	)
+	for i, line := range strings.SplitAfter(text, "\n") {
+		col := 0
+		for j := 0; j < len(line); {
+			r, size := utf8.DecodeRuneInString(line[j:])
+			j += size
+			col++
+			if r == utf8.RuneError && size == 1 {
+				chars = append(chars, UnmappableChar{i + 1, col, r})
+				out.WriteByte('?')
+				continue
+			}
+			if _, err := opts.Encoding.NewEncoder().String(string(r)); err != nil {
+				if r != bom {
+					chars = append(chars, UnmappableChar{i + 1, col, r})
+					out.WriteByte('?')
+				}
+				continue
+			}
+			out.WriteRune(r)
+		}
+	}
+	return out.String(), chars
+}
+
+func normalizeEOL(text, eol string) string {
+	text = strings.Replace(text, "\r\n", "\n", -1)
+	text = strings.Replace(text, "\r", "\n", -1)
+	if eol != "\n" {
+		text = strings.Replace(text, "\n", eol, -1)
+	}
+	return text
+}
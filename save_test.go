@@ -0,0 +1,191 @@
+package osdb
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+func TestSaveDefaults(t *testing.T) {
+	in := "\uFEFF1\r\n00:00:01,000 --> 00:00:02,000\r\nHéllo\r\n"
+	out := new(bytes.Buffer)
+	if err := (SaveOptions{}).Save(out, strings.NewReader(in)); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if out.String() != in {
+		t.Fatalf("Expected untouched text, got %q", out.String())
+	}
+}
+
+func TestSaveWithEncodingAndCRLF(t *testing.T) {
+	in := "\uFEFF1\n00:00:01,000 --> 00:00:02,000\nŽluťoučký kůň\n"
+	opts := SaveOptions{
+		Encoding: charmap.Windows1250,
+		BOM:      BOMStrip,
+		EOL:      LineEndingCRLF,
+	}
+	out := new(bytes.Buffer)
+	if err := opts.Save(out, strings.NewReader(in)); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	expected := "1\r\n00:00:01,000 --> 00:00:02,000\r\n\x8Elu\x9Dou\xE8k\xFD k\xF9\xF2\r\n"
+	if out.String() != expected {
+		t.Fatalf("Expected %q, got %q", expected, out.String())
+	}
+}
+
+func TestSaveKeepsBOMOnlyForUnicode(t *testing.T) {
+	in := "\uFEFFHello\n"
+	out := new(bytes.Buffer)
+	opts := SaveOptions{Encoding: charmap.ISO8859_2}
+	if err := opts.Save(out, strings.NewReader(in)); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if out.String() != "Hello\n" {
+		t.Fatalf("Expected BOM to be dropped, got %q", out.String())
+	}
+
+	opts.BOM = BOMAdd
+	if err := opts.Save(new(bytes.Buffer), strings.NewReader(in)); err == nil {
+		t.Fatalf("Expected an error when adding a BOM to ISO-8859-2")
+	}
+}
+
+func TestSaveReportsUnmappable(t *testing.T) {
+	in := "Hello\nПривет ø\n"
+	opts := SaveOptions{Encoding: charmap.Windows1250}
+
+	out := new(bytes.Buffer)
+	err := opts.Save(out, strings.NewReader(in))
+	uerr, ok := err.(*UnmappableError)
+	if !ok {
+		t.Fatalf("Expected *UnmappableError, got: %v", err)
+	}
+	if len(uerr.Chars) != 7 {
+		t.Fatalf("Expected 7 unmappable chars, got %d", len(uerr.Chars))
+	}
+	if c := uerr.Chars[0]; c.Line != 2 || c.Column != 1 || c.Rune != 'П' {
+		t.Fatalf("Unexpected first unmappable char: %+v", c)
+	}
+	if out.Len() != 0 {
+		t.Fatalf("Expected nothing written, got %q", out.String())
+	}
+
+	opts.Substitute = true
+	err = opts.Save(out, strings.NewReader(in))
+	if _, ok := err.(*UnmappableError); !ok {
+		t.Fatalf("Expected *UnmappableError, got: %v", err)
+	}
+	if out.String() != "Hello\n?????? ?\n" {
+		t.Fatalf("Expected substituted text, got %q", out.String())
+	}
+}
+
+func TestSaveUTF16(t *testing.T) {
+	var (
+		le      = unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM)
+		leBOM   = unicode.UTF16(unicode.LittleEndian, unicode.UseBOM)
+		beBOM   = unicode.UTF16(unicode.BigEndian, unicode.UseBOM)
+		text    = "ab\ncd\n"
+		withBOM = "\uFEFF" + text
+		leText  = "a\x00b\x00\n\x00c\x00d\x00\n\x00"
+	)
+	for _, tt := range []struct {
+		name string
+		opts SaveOptions
+		in   string
+		out  string
+	}{
+		{"strip", SaveOptions{Encoding: le, BOM: BOMStrip}, withBOM, leText},
+		{"keep", SaveOptions{Encoding: le}, withBOM, "\xff\xfe" + leText},
+		{"keep none", SaveOptions{Encoding: le}, text, leText},
+		{"add", SaveOptions{Encoding: le, BOM: BOMAdd}, text, "\xff\xfe" + leText},
+		{"encoder BOM, strip", SaveOptions{Encoding: leBOM, BOM: BOMStrip}, withBOM, leText},
+		{"encoder BOM, keep", SaveOptions{Encoding: leBOM}, withBOM, "\xff\xfe" + leText},
+		{"encoder BOM, keep none", SaveOptions{Encoding: leBOM}, text, leText},
+		{"encoder BOM, add", SaveOptions{Encoding: beBOM, BOM: BOMAdd}, "a\n", "\xfe\xff\x00a\x00\n"},
+		{"CRLF", SaveOptions{Encoding: le, EOL: LineEndingCRLF}, "a\n", "a\x00\r\x00\n\x00"},
+	} {
+		out := new(bytes.Buffer)
+		if err := tt.opts.Save(out, strings.NewReader(tt.in)); err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+			continue
+		}
+		if out.String() != tt.out {
+			t.Errorf("%s: expected %x, got %x", tt.name, tt.out, out.String())
+		}
+	}
+}
+
+// An encoder of ASCII, which also represents U+FFFD, as 0x1a.
+type asciiEncoder struct{ transform.NopResetter }
+
+func (asciiEncoder) Transform(dst, src []byte, atEOF bool) (nDst, nSrc int, err error) {
+	for nSrc < len(src) {
+		if !atEOF && !utf8.FullRune(src[nSrc:]) {
+			return nDst, nSrc, transform.ErrShortSrc
+		}
+		if nDst >= len(dst) {
+			return nDst, nSrc, transform.ErrShortDst
+		}
+		r, size := utf8.DecodeRune(src[nSrc:])
+		switch {
+		case r == utf8.RuneError && size == 3:
+			dst[nDst] = 0x1a
+		case r < utf8.RuneSelf && size == 1:
+			dst[nDst] = byte(r)
+		default:
+			return nDst, nSrc, errors.New("unmappable character")
+		}
+		nDst++
+		nSrc += size
+	}
+	return nDst, nSrc, nil
+}
+
+type asciiEncoding struct{}
+
+func (asciiEncoding) NewDecoder() *encoding.Decoder {
+	return &encoding.Decoder{Transformer: transform.Nop}
+}
+
+func (asciiEncoding) NewEncoder() *encoding.Encoder {
+	return &encoding.Encoder{Transformer: asciiEncoder{}}
+}
+
+func TestSaveReplacementCharacter(t *testing.T) {
+	// U+FFFD is text here, but the invalid byte and ø are not.
+	in := "a\uFFFDb \xff\u00f8\n"
+	opts := SaveOptions{Encoding: asciiEncoding{}, Substitute: true}
+
+	out := new(bytes.Buffer)
+	err := opts.Save(out, strings.NewReader(in))
+	uerr, ok := err.(*UnmappableError)
+	if !ok {
+		t.Fatalf("Expected *UnmappableError, got: %v", err)
+	}
+	if len(uerr.Chars) != 2 || uerr.Chars[0].Column != 5 || uerr.Chars[1].Rune != 'ø' {
+		t.Fatalf("Expected the invalid byte and ø to be unmappable, got %+v", uerr.Chars)
+	}
+	if out.String() != "a\x1ab ??\n" {
+		t.Fatalf("Expected substituted text, got %q", out.String())
+	}
+}
+
+func TestEncodingByName(t *testing.T) {
+	for _, name := range []string{"windows-1251", "ISO-8859-2", "utf-8"} {
+		if _, err := EncodingByName(name); err != nil {
+			t.Fatalf("Expected encoding for %s, got: %v", name, err)
+		}
+	}
+	if _, err := EncodingByName("klingon"); err == nil {
+		t.Fatalf("Expected an error for an unknown encoding")
+	}
+}
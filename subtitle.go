@@ -7,11 +7,14 @@ import (
 	"encoding/base64"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"path"
+	"regexp"
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"golang.org/x/text/encoding"
 )
@@ -70,6 +73,36 @@ type Subtitle struct {
 	subFilePath         string
 }
 
+// MovieDuration returns the movie length known to OSDB, from
+// MovieTimeMS, or 0 when it is unknown.
+func (s *Subtitle) MovieDuration() time.Duration {
+	ms, err := strconv.ParseInt(s.MovieTimeMS, 10, 64)
+	if err != nil || ms < 0 {
+		return 0
+	}
+	return time.Duration(ms) * time.Millisecond
+}
+
+// CDCount returns the number of parts ("CDs") in the subtitle's set,
+// from SubSumCD, and at least 1.
+func (s *Subtitle) CDCount() int {
+	n, err := strconv.Atoi(s.SubSumCD)
+	if err != nil || n < 1 {
+		return 1
+	}
+	return n
+}
+
+// CDNumber returns which part ("CD") of the subtitle's set this file
+// is, from SubActualCD, starting at 1.
+func (s *Subtitle) CDNumber() int {
+	n, err := strconv.Atoi(s.SubActualCD)
+	if err != nil || n < 1 {
+		return 1
+	}
+	return n
+}
+
 func (s *Subtitle) toUploadParams() map[string]string {
 	return map[string]string{
 		"subhash":       s.SubHash,
@@ -129,39 +162,156 @@ func (subs Subtitles) Best() *Subtitle {
 	return nil
 }
 
+// Parts finds all the parts of a multi-CD subtitle in a collection, in
+// CD order. Parts share the same IDSubtitle, and it returns nil unless
+// all s.CDCount() parts are found.
+func (subs Subtitles) Parts(s *Subtitle) Subtitles {
+	count := s.CDCount()
+	parts := make(Subtitles, count)
+	found := 0
+	for _, sub := range subs {
+		cd := sub.CDNumber()
+		if sub.IDSubtitle != s.IDSubtitle || cd > count || parts[cd-1].IDSubtitleFile != "" {
+			continue
+		}
+		parts[cd-1] = sub
+		found++
+	}
+	if found != count {
+		return nil
+	}
+	return parts
+}
+
 // SubtitleFile contains file data as returned by OSDB's API, that is to
 // say: gzip-ped and base64-encoded text.
 type SubtitleFile struct {
 	ID       string `xmlrpc:"idsubtitlefile"`
 	Data     string `xmlrpc:"data"`
 	Encoding encoding.Encoding
-	reader   io.ReadCloser
+
+	raw     []byte            // decompressed Data
+	text    []byte            // raw, decoded with textEnc
+	textEnc encoding.Encoding // Encoding used to build text
 }
 
-// Reader interface for SubtitleFile. Subtitle's contents are
-// decompressed, and usually encoded to UTF-8: if encoding info is
-// missing, no re-encoding is done.
-func (sf *SubtitleFile) Reader() (r io.ReadCloser, err error) {
-	if sf.reader != nil {
-		return sf.reader, err
+// Raw returns the subtitle file as stored on OSDB: decompressed, but
+// not re-encoded.
+func (sf *SubtitleFile) Raw() ([]byte, error) {
+	if sf.raw != nil {
+		return sf.raw, nil
 	}
 
 	dec := base64.NewDecoder(base64.StdEncoding, strings.NewReader(sf.Data))
 	gzReader, err := gzip.NewReader(dec)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("subtitle file %s: %s", sf.ID, err)
 	}
+	defer gzReader.Close()
+	raw, err := ioutil.ReadAll(gzReader)
+	if err != nil {
+		return nil, fmt.Errorf("subtitle file %s: %s", sf.ID, err)
+	}
+	sf.raw = raw
+	return sf.raw, nil
+}
 
+// Bytes returns the subtitle's contents, decompressed, and usually
+// encoded to UTF-8: if encoding info is missing, no re-encoding is done.
+func (sf *SubtitleFile) Bytes() ([]byte, error) {
+	if sf.text != nil && sf.textEnc == sf.Encoding {
+		return sf.text, nil
+	}
+	raw, err := sf.Raw()
+	if err != nil {
+		return nil, err
+	}
 	if sf.Encoding == nil {
-		sf.reader = gzReader
+		sf.text = raw
 	} else {
-		sf.reader = newCloseableReader(
-			sf.Encoding.NewDecoder().Reader(gzReader),
-			gzReader.Close,
-		)
+		text, err := sf.Encoding.NewDecoder().Bytes(raw)
+		if err != nil {
+			return nil, fmt.Errorf("subtitle file %s: %s", sf.ID, err)
+		}
+		sf.text = text
+	}
+	sf.textEnc = sf.Encoding
+	return sf.text, nil
+}
+
+// Text returns the subtitle's contents as a string, see Bytes.
+func (sf *SubtitleFile) Text() (string, error) {
+	b, err := sf.Bytes()
+	return string(b), err
+}
+
+// Size returns the length in bytes of the subtitle's contents, see
+// Bytes.
+func (sf *SubtitleFile) Size() (int64, error) {
+	b, err := sf.Bytes()
+	return int64(len(b)), err
+}
+
+// MD5 returns the hex-encoded md5 checksum of the file as stored on OSDB,
+// to compare with Subtitle.SubHash.
+func (sf *SubtitleFile) MD5() (string, error) {
+	raw, err := sf.Raw()
+	if err != nil {
+		return "", err
 	}
+	return fmt.Sprintf("%x", md5.Sum(raw)), nil
+}
 
-	return sf.reader, nil
+// Lines starting subtitle formats which OSDB stores, other than SRT.
+var formatSniffers = []struct {
+	format string
+	re     *regexp.Regexp
+}{
+	{"vtt", regexp.MustCompile(`\AWEBVTT`)},
+	{"ass", regexp.MustCompile(`(?mi)^ScriptType:\s*v4\.00\+`)},
+	{"ssa", regexp.MustCompile(`(?mi)^\[Script Info\]`)},
+	{"smi", regexp.MustCompile(`(?i)<SAMI>`)},
+	{"sub", regexp.MustCompile(`(?m)^\{\d+\}\{\d*\}`)},
+	{"mpl", regexp.MustCompile(`(?m)^\[\d+\]\[\d*\]`)},
+	{"srt", regexp.MustCompile(`\d+:\d+:\d+[,.]\d+ +--> +\d+:\d+:\d+[,.]\d+`)},
+	{"tmp", regexp.MustCompile(`(?m)^\d+:\d+:\d+:`)},
+}
+
+// Format guesses the subtitle's format from its contents, e.g. "srt",
+// "vtt" or "ass", since DownloadSubtitles doesn't tell it. Use
+// Subtitle.SubFormat instead when the subtitle's metadata is known.
+// Unknown formats are "txt".
+func (sf *SubtitleFile) Format() (string, error) {
+	raw, err := sf.Raw()
+	if err != nil {
+		return "", err
+	}
+	raw = bytes.TrimPrefix(raw, []byte("\xef\xbb\xbf"))
+	for _, s := range formatSniffers {
+		if s.re.Match(raw) {
+			return s.format, nil
+		}
+	}
+	return "txt", nil
+}
+
+// Parse the subtitle's contents into a Document.
+func (sf *SubtitleFile) Parse() (*Document, error) {
+	b, err := sf.Bytes()
+	if err != nil {
+		return nil, err
+	}
+	return ParseBytes(b)
+}
+
+// Reader interface for SubtitleFile, see Bytes. Each call returns a new
+// reader, starting from the beginning of the file.
+func (sf *SubtitleFile) Reader() (r io.ReadCloser, err error) {
+	b, err := sf.Bytes()
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.NopCloser(bytes.NewReader(b)), nil
 }
 
 // NewSubtitles builds a Subtitles from a movie path and a slice of
@@ -217,6 +367,38 @@ func NewSubtitle(moviePath string, subPath string, langID string) (s Subtitle, e
 	return
 }
 
+// ValidateUpload checks that subs can be sent to HasSubtitles and
+// UploadSubtitles: all mandatory fields are set, all parts belong to
+// the same movie, and the upload payload can be built from the files.
+func (subs Subtitles) ValidateUpload() error {
+	if len(subs) == 0 {
+		return fmt.Errorf("no subtitles to upload")
+	}
+	for i, s := range subs {
+		fields := []struct{ name, value string }{
+			{"SubHash", s.SubHash},
+			{"SubFileName", s.SubFileName},
+			{"SubLanguageID", s.SubLanguageID},
+			{"MovieHash", s.MovieHash},
+			{"MovieByteSize", s.MovieByteSize},
+			{"MovieFileName", s.MovieFileName},
+		}
+		for _, f := range fields {
+			if f.value == "" {
+				return fmt.Errorf("cd%d: missing %s", i+1, f.name)
+			}
+		}
+		if s.SubLanguageID != subs[0].SubLanguageID {
+			return fmt.Errorf("cd%d: language %s differs from %s", i+1, s.SubLanguageID, subs[0].SubLanguageID)
+		}
+	}
+	if _, err := subs.toTryUploadParams(); err != nil {
+		return err
+	}
+	_, err := subs.toUploadParams()
+	return err
+}
+
 // Serialize Subtitle to OSDB's XMLRPC params when trying to upload.
 func (subs *Subtitles) toTryUploadParams() (map[string]interface{}, error) {
 	subMap := map[string]interface{}{}
@@ -251,19 +433,3 @@ func (subs *Subtitles) toUploadParams() (map[string]interface{}, error) {
 
 	return params, nil
 }
-
-// Implement io.ReadCloser by wrapping io.Reader
-type closeableReader struct {
-	io.Reader
-	close func() error
-}
-
-// Close the reader by calling a preset close function
-func (c *closeableReader) Close() error {
-	return c.close()
-}
-
-// Create a ReadCloser which will read from r and call close() upon closing
-func newCloseableReader(r io.Reader, close func() error) io.ReadCloser {
-	return &closeableReader{r, close}
-}
@@ -1,9 +1,14 @@
 package osdb
 
 import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
 	"io/ioutil"
 	"os"
 	"testing"
+
+	"golang.org/x/text/encoding/charmap"
 )
 
 func TestBestWithNoResults(t *testing.T) {
@@ -72,3 +77,155 @@ func TestNewSubtitle(t *testing.T) {
 		t.Fatalf("Expected movie Hash %s, got %s", movieHash, s.MovieHash)
 	}
 }
+
+func TestValidateUpload(t *testing.T) {
+	data := make([]byte, ChunkSize*2)
+	if err := ioutil.WriteFile("./test-upload.avi", data, 0644); err != nil {
+		t.Fatalf("Can't create test-upload.avi")
+	}
+	defer os.Remove("./test-upload.avi")
+	if err := ioutil.WriteFile("./test-upload.srt", []byte("1\n00:00:01,000 --> 00:00:02,000\nHi\n"), 0644); err != nil {
+		t.Fatalf("Can't create test-upload.srt")
+	}
+	defer os.Remove("./test-upload.srt")
+
+	subs, err := NewSubtitles("./test-upload.avi", []string{"./test-upload.srt"}, "eng")
+	if err != nil {
+		t.Fatalf("Expected Subtitles, got error: %v", err)
+	}
+	if err := subs.ValidateUpload(); err != nil {
+		t.Fatalf("Expected valid upload, got: %v", err)
+	}
+
+	if err := (Subtitles{}).ValidateUpload(); err == nil {
+		t.Fatalf("Expected an error for empty subtitles")
+	}
+
+	missing := Subtitles{subs[0]}
+	missing[0].MovieHash = ""
+	if err := missing.ValidateUpload(); err == nil || err.Error() != "cd1: missing MovieHash" {
+		t.Fatalf("Expected missing MovieHash error, got: %v", err)
+	}
+
+	gone := Subtitles{subs[0]}
+	gone[0].subFilePath = "./test-upload-missing.srt"
+	if err := gone.ValidateUpload(); err == nil {
+		t.Fatalf("Expected an error for a missing subtitle file")
+	}
+}
+
+// Build a SubtitleFile, as returned by OSDB, from raw file contents.
+func newTestSubtitleFile(raw []byte) SubtitleFile {
+	buf := new(bytes.Buffer)
+	enc := base64.NewEncoder(base64.StdEncoding, buf)
+	gz := gzip.NewWriter(enc)
+	gz.Write(raw)
+	gz.Close()
+	enc.Close()
+	return SubtitleFile{ID: "1", Data: buf.String()}
+}
+
+func TestSubtitleFileContents(t *testing.T) {
+	raw := []byte("1\n00:00:01,000 --> 00:00:02,500\nD\xe9j\xe0 vu\n")
+	sf := newTestSubtitleFile(raw)
+	sf.Encoding = charmap.Windows1252
+
+	text, err := sf.Text()
+	if err != nil {
+		t.Fatalf("Expected text, got error: %v", err)
+	}
+	if text != "1\n00:00:01,000 --> 00:00:02,500\nDéjà vu\n" {
+		t.Fatalf("Unexpected text: %q", text)
+	}
+
+	size, err := sf.Size()
+	if err != nil || size != int64(len(text)) {
+		t.Fatalf("Expected size %d, got %d (%v)", len(text), size, err)
+	}
+
+	sum, err := sf.MD5()
+	if err != nil {
+		t.Fatalf("Expected md5, got error: %v", err)
+	}
+	if sum != "dba52d460ae263d063d11c48cedda7b6" {
+		t.Fatalf("Unexpected md5: %s", sum)
+	}
+
+	doc, err := sf.Parse()
+	if err != nil {
+		t.Fatalf("Expected document, got error: %v", err)
+	}
+	if len(doc.Cues) != 1 || doc.Cues[0].Text() != "Déjà vu" {
+		t.Fatalf("Unexpected document: %+v", doc)
+	}
+}
+
+func TestSubtitleFileFormat(t *testing.T) {
+	for _, test := range []struct {
+		raw    string
+		format string
+	}{
+		{"1\n00:00:01,000 --> 00:00:02,500\nHello\n", "srt"},
+		{"\xef\xbb\xbfWEBVTT\n\n00:01.000 --> 00:02.500\nHello\n", "vtt"},
+		{"[Script Info]\nScriptType: v4.00+\n", "ass"},
+		{"[Script Info]\nScriptType: v4.00\n", "ssa"},
+		{"<SAMI>\n<BODY>\n", "smi"},
+		{"{100}{200}Hello\n", "sub"},
+		{"[10][20]Hello\n", "mpl"},
+		{"00:00:01:Hello\n", "tmp"},
+		{"Hello\n", "txt"},
+	} {
+		sf := newTestSubtitleFile([]byte(test.raw))
+		format, err := sf.Format()
+		if err != nil {
+			t.Fatalf("Expected format, got error: %v", err)
+		}
+		if format != test.format {
+			t.Fatalf("Expected %s for %q, got %s", test.format, test.raw, format)
+		}
+	}
+}
+
+func TestSubtitleFileReaderIsReusable(t *testing.T) {
+	sf := newTestSubtitleFile([]byte("some text"))
+	for i := 0; i < 2; i++ {
+		r, err := sf.Reader()
+		if err != nil {
+			t.Fatalf("Expected reader, got error: %v", err)
+		}
+		b, _ := ioutil.ReadAll(r)
+		r.Close()
+		if string(b) != "some text" {
+			t.Fatalf("Read #%d: expected \"some text\", got %q", i+1, b)
+		}
+	}
+}
+
+func TestSubtitleFileWithBadData(t *testing.T) {
+	sf := SubtitleFile{ID: "1", Data: "not base64, nor gzip"}
+	if _, err := sf.Reader(); err == nil {
+		t.Fatalf("Expected an error, got none")
+	}
+	if _, err := sf.MD5(); err == nil {
+		t.Fatalf("Expected an error, got none")
+	}
+}
+
+func TestParts(t *testing.T) {
+	subs := Subtitles{
+		{IDSubtitle: "1", IDSubtitleFile: "12", SubSumCD: "2", SubActualCD: "2"},
+		{IDSubtitle: "2", IDSubtitleFile: "21", SubSumCD: "1", SubActualCD: "1"},
+		{IDSubtitle: "1", IDSubtitleFile: "11", SubSumCD: "2", SubActualCD: "1"},
+	}
+	parts := subs.Parts(&subs[0])
+	if len(parts) != 2 {
+		t.Fatalf("Expected 2 parts, got %d", len(parts))
+	}
+	if parts[0].IDSubtitleFile != "11" || parts[1].IDSubtitleFile != "12" {
+		t.Fatalf("Unexpected parts: %v", parts)
+	}
+
+	if parts := subs[:2].Parts(&subs[0]); parts != nil {
+		t.Fatalf("Expected nil with missing parts, got %v", parts)
+	}
+}